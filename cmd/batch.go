@@ -0,0 +1,157 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+var (
+	batchFile string
+	batchJobs int
+)
+
+// parseBatchFile reads one job per line:
+//
+//	<url or file> [output name] [video-id=<id>] [audio-id=<id>]
+//
+// Empty lines and lines starting with # are ignored. Unset fields fall back
+// to the command line flags.
+func parseBatchFile(data []byte) ([]*job, error) {
+	jobs := []*job{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		j := &job{
+			input:   fields[0],
+			videoId: videoId,
+			audioId: audioId,
+		}
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			switch {
+			case !ok && len(j.outputFilename) == 0:
+				j.outputFilename = field
+			case key == "output":
+				j.outputFilename = value
+			case key == "video-id":
+				j.videoId = value
+			case key == "audio-id":
+				j.audioId = value
+			default:
+				return nil, fmt.Errorf("line %d: unknown field '%s'", n, field)
+			}
+		}
+
+		jobs = append(jobs, j)
+	}
+
+	return jobs, scanner.Err()
+}
+
+// runBatch downloads every job of the batch file with up to batchJobs jobs
+// at a time, and fails if any of them failed.
+func runBatch(ctx context.Context, filename string) error {
+	data, err := readInput(filename)
+	if err != nil {
+		return err
+	}
+
+	jobs, err := parseBatchFile(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	if len(jobs) == 0 {
+		return errors.New("no urls in " + filename)
+	}
+
+	parallelism := batchJobs
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	errs := make([]error, len(jobs))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < parallelism; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range queue {
+				printInfo(fmt.Sprintf("[%d/%d] %s", i+1, len(jobs), jobs[i].input))
+				client := newClient()
+				if parallelism > 1 {
+					client.Hooks = progressHooks(fmt.Sprintf("[%d/%d] ", i+1, len(jobs)))
+				}
+				errs[i] = download(ctx, client, jobs[i])
+				if errs[i] != nil {
+					fmt.Printf("[%d/%d] ", i+1, len(jobs))
+					printError(errs[i])
+				}
+			}
+		}()
+	}
+
+	for i := range jobs {
+		// jobs which are not started when interrupted are failed
+		if ctx.Err() != nil {
+			errs[i] = ctx.Err()
+			continue
+		}
+
+		select {
+		case queue <- i:
+		case <-ctx.Done():
+			errs[i] = ctx.Err()
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+
+	printInfo(fmt.Sprintf("Summary: %d succeeded, %d failed", len(jobs)-failed, failed))
+	for i, err := range errs {
+		if err != nil {
+			fmt.Printf("  %s: %v\n", jobs[i].input, err)
+		}
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d jobs failed", failed, len(jobs))
+	}
+
+	return nil
+}
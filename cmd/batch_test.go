@@ -0,0 +1,79 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseBatchFile(t *testing.T) {
+	videoId, audioId = "default-video", ""
+	defer func() {
+		videoId, audioId = "", ""
+	}()
+
+	data := []byte(`# comment
+https://example.com/1/master.json
+
+  https://example.com/2/master.json keynote
+https://example.com/3/master.json output=session-1 video-id=720p audio-id=a1
+master.json video-id=360p name
+	# indented comment
+`)
+
+	jobs, err := parseBatchFile(data)
+	if err != nil {
+		t.Errorf("parseBatchFile failed: %v", err)
+		return
+	}
+
+	expected := []*job{
+		&job{input: "https://example.com/1/master.json", videoId: "default-video"},
+		&job{input: "https://example.com/2/master.json", outputFilename: "keynote", videoId: "default-video"},
+		&job{input: "https://example.com/3/master.json", outputFilename: "session-1", videoId: "720p", audioId: "a1"},
+		&job{input: "master.json", outputFilename: "name", videoId: "360p"},
+	}
+	if !reflect.DeepEqual(expected, jobs) {
+		t.Errorf("parseBatchFile does not match.\nexpected: %+v\nactual:   %+v", expected, jobs)
+		return
+	}
+}
+
+func TestParseBatchFileRejectsUnknownFields(t *testing.T) {
+	tests := []struct {
+		data     string
+		expected string
+	}{
+		{"https://example.com/master.json foo=bar", "line 1: unknown field 'foo=bar'"},
+		{"# comment\nhttps://example.com/master.json name other", "line 2: unknown field 'other'"},
+	}
+
+	for _, test := range tests {
+		_, err := parseBatchFile([]byte(test.data))
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("parseBatchFile(%q) error does not match.\nexpected: %v\nactual:   %v", test.data, test.expected, err)
+			return
+		}
+	}
+}
+
+func TestParseBatchFileWithoutJobs(t *testing.T) {
+	jobs, err := parseBatchFile([]byte("\n# only comments\n\n"))
+	if err != nil || len(jobs) != 0 {
+		t.Errorf("parseBatchFile must return no jobs: %v, %v", jobs, err)
+		return
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+
+	"github.com/akiomik/vimeo-dl/vimeo"
+)
+
+// job is a single download. Empty fields fall back to the defaults, e.g.
+// the output template for outputFilename and the highest bitrate for the ids.
+type job struct {
+	input          string
+	outputFilename string
+	videoId        string
+	audioId        string
+}
+
+func download(ctx context.Context, client *vimeo.Client, j *job) error {
+	masterJson, masterJsonUrl, err := loadMasterJson(ctx, client, j.input)
+	if err != nil {
+		return err
+	}
+
+	err = checkSegmentUrls(j.input, masterJson, masterJsonUrl)
+	if err != nil {
+		return err
+	}
+
+	options, err := downloadOptions(j)
+	if err != nil {
+		return err
+	}
+
+	downloader := &vimeo.Downloader{Client: client, Options: options}
+	result, err := downloader.DownloadMasterJson(ctx, masterJson, masterJsonUrl)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%w (use --overwrite or --skip-existing)", err)
+	}
+	var corruptErr base64.CorruptInputError
+	if errors.As(err, &corruptErr) && !isRemote(j.input) && len(playerConfig) == 0 && masterJsonUrl.IsAbs() {
+		// a saved master.json is not fetched again with base64_init=1 like a
+		// remote one, so tell how to save one with embedded init segments
+		return fmt.Errorf("%w\nTry this url: %s", err, base64InitUrl(masterJsonUrl))
+	}
+	if err != nil {
+		return err
+	}
+
+	// printed through the hooks, so that parallel batch jobs are prefixed
+	if !result.Skipped && client.Hooks.Info != nil {
+		client.Hooks.Info("Done!")
+	}
+	return nil
+}
+
+func downloadOptions(j *job) (vimeo.DownloadOptions, error) {
+	start, end, err := parseTimeRange()
+	if err != nil {
+		return vimeo.DownloadOptions{}, err
+	}
+
+	options := vimeo.DownloadOptions{
+		VideoId:          j.videoId,
+		AudioId:          j.audioId,
+		Format:           formatSelector,
+		Start:            start,
+		End:              end,
+		RebaseTimestamps: rebaseTimestamps,
+		OutputDir:        outputDir,
+		OutputFilename:   j.outputFilename,
+		OutputTemplate:   outputTemplate,
+		Combine:          combine,
+		Resume:           resume,
+		Archive:          archive,
+	}
+
+	switch {
+	case overwrite:
+		options.Overwrite = vimeo.Overwrite
+	case skipExisting:
+		options.Overwrite = vimeo.SkipExisting
+	default:
+		options.Overwrite = vimeo.NoOverwrite
+	}
+
+	return options, nil
+}
+
+func base64InitUrl(masterJsonUrl *url.URL) string {
+	query := masterJsonUrl.Query()
+	query.Set("base64_init", "1")
+	u := *masterJsonUrl
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
@@ -0,0 +1,183 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/akiomik/vimeo-dl/vimeo"
+	"github.com/spf13/cobra"
+)
+
+var formatsJson bool
+
+type format struct {
+	Type          string  `json:"type"`
+	Id            string  `json:"id"`
+	Width         int     `json:"width,omitempty"`
+	Height        int     `json:"height,omitempty"`
+	Framerate     float64 `json:"framerate,omitempty"`
+	Channels      int     `json:"channels,omitempty"`
+	SampleRate    int     `json:"sample_rate,omitempty"`
+	Codecs        string  `json:"codecs"`
+	Bitrate       int     `json:"bitrate"`
+	AvgBitrate    int     `json:"avg_bitrate,omitempty"`
+	Duration      float64 `json:"duration,omitempty"`
+	Segments      int     `json:"segments"`
+	EstimatedSize int64   `json:"estimated_size"`
+}
+
+var formatsCmd = &cobra.Command{
+	Use:   "formats",
+	Short: "List available video and audio formats",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, stop := notifyContext()
+		defer stop()
+
+		client := newClient()
+		masterJson, _, err := loadMasterJson(ctx, client, input)
+		if err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+
+		formats := listFormats(masterJson)
+		if formatsJson {
+			err = printFormatsJson(formats)
+		} else {
+			err = printFormatsTable(formats)
+		}
+		if err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	addInputFlags(formatsCmd)
+	formatsCmd.MarkFlagsOneRequired("input", "player-config", "har")
+	formatsCmd.MarkFlagsMutuallyExclusive("input", "player-config", "har")
+	formatsCmd.Flags().StringVarP(&userAgent, "user-agent", "", "", "user-agent for request")
+	formatsCmd.Flags().BoolVarP(&formatsJson, "json", "", false, "print formats as json")
+	rootCmd.AddCommand(formatsCmd)
+}
+
+// listFormats returns video formats ordered by resolution and bitrate,
+// followed by audio formats ordered by bitrate.
+func listFormats(masterJson *vimeo.MasterJson) []format {
+	videos := make([]format, len(masterJson.Video))
+	for i, v := range masterJson.Video {
+		videos[i] = format{
+			Type:          "video",
+			Id:            v.Id,
+			Width:         v.Width,
+			Height:        v.Height,
+			Framerate:     v.Framerate,
+			Codecs:        v.Codecs,
+			Bitrate:       v.Bitrate,
+			AvgBitrate:    v.AvgBitrate,
+			Duration:      v.Duration,
+			Segments:      len(v.Segments),
+			EstimatedSize: v.EstimatedSize(),
+		}
+	}
+	sort.SliceStable(videos, func(i, j int) bool {
+		if videos[i].Height != videos[j].Height {
+			return videos[i].Height < videos[j].Height
+		}
+		return videos[i].Bitrate < videos[j].Bitrate
+	})
+
+	audios := make([]format, len(masterJson.Audio))
+	for i, a := range masterJson.Audio {
+		audios[i] = format{
+			Type:          "audio",
+			Id:            a.Id,
+			Channels:      a.Channels,
+			SampleRate:    a.SampleRate,
+			Codecs:        a.Codecs,
+			Bitrate:       a.Bitrate,
+			AvgBitrate:    a.AvgBitrate,
+			Duration:      a.Duration,
+			Segments:      len(a.Segments),
+			EstimatedSize: a.EstimatedSize(),
+		}
+	}
+	sort.SliceStable(audios, func(i, j int) bool {
+		return audios[i].Bitrate < audios[j].Bitrate
+	})
+
+	return append(videos, audios...)
+}
+
+func printFormatsJson(formats []format) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(formats)
+}
+
+func printFormatsTable(formats []format) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TYPE\tID\tRESOLUTION\tCODEC\tBITRATE\tSEGMENTS\tSIZE")
+	for _, f := range formats {
+		resolution := "-"
+		if f.Type == "video" && f.Width > 0 && f.Height > 0 {
+			resolution = fmt.Sprintf("%dx%d", f.Width, f.Height)
+			if f.Framerate > 0 {
+				resolution += "@" + strconv.FormatFloat(f.Framerate, 'f', -1, 64)
+			}
+		} else if f.Type == "audio" && f.Channels > 0 {
+			resolution = fmt.Sprintf("%dch", f.Channels)
+			if f.SampleRate > 0 {
+				resolution += fmt.Sprintf(" %dHz", f.SampleRate)
+			}
+		}
+
+		codec := f.Codecs
+		if codec == "" {
+			codec = "-"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%dk\t%d\t%s\n", f.Type, f.Id, resolution, codec, f.Bitrate/1000, f.Segments, formatSize(f.EstimatedSize))
+	}
+
+	return w.Flush()
+}
+
+func formatSize(size int64) string {
+	if size <= 0 {
+		return "-"
+	}
+
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+
+	if unit == 0 {
+		return fmt.Sprintf("%d%s", size, units[unit])
+	}
+
+	return fmt.Sprintf("%.1f%s", value, units[unit])
+}
@@ -0,0 +1,224 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/akiomik/vimeo-dl/vimeo"
+	"github.com/spf13/cobra"
+)
+
+var (
+	playerConfig string
+	cdn          string
+	baseUrl      string
+	harFile      string
+	harIndex     int
+)
+
+func addInputFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&input, "input", "i", "", "url for master.json, or a saved master.json file (- for stdin)")
+	cmd.Flags().StringVarP(&baseUrl, "base-url", "", "", "url of a saved master.json to resolve its segment urls")
+	cmd.Flags().StringVarP(&playerConfig, "player-config", "", "", "player config json (file, url or - for stdin) to find master.json in")
+	cmd.Flags().StringVarP(&cdn, "cdn", "", "", "cdn of the player config (default: its default cdn)")
+	cmd.Flags().StringVarP(&harFile, "har", "", "", "HAR file exported from the browser to find master.json in")
+	cmd.Flags().IntVarP(&harIndex, "har-index", "", 0, "clip to use when the HAR file has several, starting at 1")
+}
+
+// loadMasterJson fetches master.json from source, or reads it from a file
+// or stdin. The returned url is the one segment urls are resolved against.
+func loadMasterJson(ctx context.Context, client *vimeo.Client, source string) (*vimeo.MasterJson, *url.URL, error) {
+	if len(harFile) > 0 {
+		return loadMasterJsonFromHar(ctx, client)
+	}
+
+	if len(playerConfig) > 0 || isRemote(source) {
+		if len(baseUrl) > 0 {
+			return nil, nil, errors.New("--base-url is only for a saved master.json")
+		}
+
+		masterJsonUrl, err := resolveMasterJsonUrl(ctx, client, source)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		masterJson, err := client.GetMasterJsonContext(ctx, masterJsonUrl)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return masterJson, masterJsonUrl, nil
+	}
+
+	data, err := readInput(source)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	masterJson, err := vimeo.ParseMasterJson(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	masterJsonUrl, err := url.Parse(baseUrl)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return masterJson, masterJsonUrl, nil
+}
+
+// loadMasterJsonFromHar uses master.json recorded in the HAR file, or fetches
+// it if the response was not recorded. The request headers of the browser are
+// reused for every request.
+func loadMasterJsonFromHar(ctx context.Context, client *vimeo.Client) (*vimeo.MasterJson, *url.URL, error) {
+	data, err := readInput(harFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	requests, err := vimeo.FindMasterJsonsInHar(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	request, err := chooseHarRequest(requests)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if harUserAgent := request.Header.Get("User-Agent"); len(harUserAgent) > 0 && len(userAgent) == 0 {
+		client.UserAgent = harUserAgent
+	}
+	request.Header.Del("User-Agent")
+	client.Header = request.Header
+
+	if request.Body != nil {
+		masterJson, err := vimeo.ParseMasterJson(request.Body)
+		if err == nil {
+			return masterJson, request.Url, nil
+		}
+	}
+
+	masterJson, err := client.GetMasterJsonContext(ctx, request.Url)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return masterJson, request.Url, nil
+}
+
+// chooseHarRequest returns the request chosen by --har-index, or the only
+// one. Without --har-index, a HAR file with several clips is an error which
+// lists them.
+func chooseHarRequest(requests []*vimeo.HarRequest) (*vimeo.HarRequest, error) {
+	if harIndex > 0 {
+		if harIndex > len(requests) {
+			return nil, fmt.Errorf("--har-index %d is out of range: the HAR file has %d clips", harIndex, len(requests))
+		}
+
+		return requests[harIndex-1], nil
+	}
+
+	if len(requests) == 1 {
+		return requests[0], nil
+	}
+
+	clips := []string{}
+	for i, request := range requests {
+		clip := request.Url.String()
+		if request.Body != nil {
+			masterJson, err := vimeo.ParseMasterJson(request.Body)
+			if err == nil && len(masterJson.ClipId) > 0 {
+				clip = masterJson.ClipId + " " + clip
+			}
+		}
+		clips = append(clips, fmt.Sprintf("  %d: %s", i+1, clip))
+	}
+
+	return nil, fmt.Errorf("the HAR file has %d clips, choose one with --har-index:\n%s", len(requests), strings.Join(clips, "\n"))
+}
+
+// checkSegmentUrls fails when segment urls cannot be resolved, i.e. a saved
+// master.json has relative urls and --base-url is not given.
+func checkSegmentUrls(source string, masterJson *vimeo.MasterJson, masterJsonUrl *url.URL) error {
+	if masterJsonUrl.IsAbs() || len(masterJson.Video) == 0 {
+		return nil
+	}
+
+	urls, err := masterJson.VideoSegmentUrls(masterJsonUrl, masterJson.Video[0].Id)
+	if err != nil {
+		return err
+	}
+
+	if len(urls) > 0 && !urls[0].IsAbs() {
+		return errors.New("--base-url is required to resolve the relative urls of " + source)
+	}
+
+	return nil
+}
+
+func isRemote(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// readInput reads a file, or stdin for "-".
+func readInput(source string) ([]byte, error) {
+	if source == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+
+	return os.ReadFile(source)
+}
+
+// resolveMasterJsonUrl returns the url given as source, or the one found in
+// the player config given by --player-config.
+func resolveMasterJsonUrl(ctx context.Context, client *vimeo.Client, source string) (*url.URL, error) {
+	if len(playerConfig) == 0 {
+		return url.Parse(source)
+	}
+
+	config, err := loadPlayerConfig(ctx, client, playerConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return config.MasterJsonUrl(cdn)
+}
+
+func loadPlayerConfig(ctx context.Context, client *vimeo.Client, source string) (*vimeo.PlayerConfig, error) {
+	if isRemote(source) {
+		configUrl, err := url.Parse(source)
+		if err != nil {
+			return nil, err
+		}
+
+		return client.GetPlayerConfigContext(ctx, configUrl)
+	}
+
+	data, err := readInput(source)
+	if err != nil {
+		return nil, err
+	}
+
+	return vimeo.ParsePlayerConfig(data)
+}
@@ -0,0 +1,169 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/akiomik/vimeo-dl/vimeo"
+)
+
+const testMasterJson = `{
+  "clip_id": "clip1",
+  "base_url": "../",
+  "video": [
+    {"id": "720p", "base_url": "720p/", "bitrate": 2000000, "init_segment": "aW5pdA==", "segments": [{"url": "segment-1.m4s"}, {"url": "segment-2.m4s"}]}
+  ],
+  "audio": []
+}`
+
+func writeTestMasterJson(t *testing.T, data string) string {
+	filename := filepath.Join(t.TempDir(), "master.json")
+	os.WriteFile(filename, []byte(data), 0644)
+
+	return filename
+}
+
+func TestLoadMasterJsonFromFile(t *testing.T) {
+	defer func() {
+		baseUrl = ""
+	}()
+
+	tests := []struct {
+		data     string
+		baseUrl  string
+		expected []string
+	}{
+		{
+			testMasterJson,
+			"https://example.com/video/1/master.json",
+			[]string{"https://example.com/video/720p/segment-1.m4s", "https://example.com/video/720p/segment-2.m4s"},
+		},
+		{
+			testMasterJson,
+			"https://example.com/video/1/",
+			[]string{"https://example.com/video/720p/segment-1.m4s", "https://example.com/video/720p/segment-2.m4s"},
+		},
+		// absolute urls need no --base-url
+		{
+			`{"clip_id": "clip1", "base_url": "https://example.com/video/", "video": [{"id": "720p", "base_url": "720p/", "segments": [{"url": "segment-1.m4s"}]}]}`,
+			"",
+			[]string{"https://example.com/video/720p/segment-1.m4s"},
+		},
+	}
+
+	for _, test := range tests {
+		baseUrl = test.baseUrl
+		source := writeTestMasterJson(t, test.data)
+		masterJson, masterJsonUrl, err := loadMasterJson(context.Background(), vimeo.NewClient(), source)
+		if err != nil {
+			t.Errorf("loadMasterJson failed: %v", err)
+			return
+		}
+
+		err = checkSegmentUrls(source, masterJson, masterJsonUrl)
+		if err != nil {
+			t.Errorf("checkSegmentUrls failed: %v", err)
+			return
+		}
+
+		urls, err := masterJson.VideoSegmentUrls(masterJsonUrl, "720p")
+		if err != nil {
+			t.Errorf("VideoSegmentUrls failed: %v", err)
+			return
+		}
+
+		actual := []string{}
+		for _, u := range urls {
+			actual = append(actual, u.String())
+		}
+		if !reflect.DeepEqual(test.expected, actual) {
+			t.Errorf("segment urls with --base-url %q do not match.\nexpected: %v\nactual:   %v", test.baseUrl, test.expected, actual)
+			return
+		}
+	}
+}
+
+func TestLoadMasterJsonRequiresBaseUrl(t *testing.T) {
+	source := writeTestMasterJson(t, testMasterJson)
+	masterJson, masterJsonUrl, err := loadMasterJson(context.Background(), vimeo.NewClient(), source)
+	if err != nil {
+		t.Errorf("loadMasterJson failed: %v", err)
+		return
+	}
+
+	err = checkSegmentUrls(source, masterJson, masterJsonUrl)
+	expected := "--base-url is required to resolve the relative urls of " + source
+	if err == nil || err.Error() != expected {
+		t.Errorf("checkSegmentUrls error does not match.\nexpected: %v\nactual:   %v", expected, err)
+		return
+	}
+}
+
+func TestLoadMasterJsonFromStdin(t *testing.T) {
+	stdin, err := os.Open(writeTestMasterJson(t, testMasterJson))
+	if err != nil {
+		t.Errorf("Open failed: %v", err)
+		return
+	}
+	defer stdin.Close()
+
+	original := os.Stdin
+	os.Stdin = stdin
+	baseUrl = "https://example.com/video/1/master.json"
+	defer func() {
+		os.Stdin = original
+		baseUrl = ""
+	}()
+
+	masterJson, masterJsonUrl, err := loadMasterJson(context.Background(), vimeo.NewClient(), "-")
+	if err != nil {
+		t.Errorf("loadMasterJson failed: %v", err)
+		return
+	}
+
+	urls, err := masterJson.VideoSegmentUrls(masterJsonUrl, "720p")
+	expected := "https://example.com/video/720p/segment-1.m4s"
+	if err != nil || len(urls) != 2 || urls[0].String() != expected {
+		t.Errorf("segment urls do not match (%v).\nexpected: %v\nactual:   %v", err, expected, urls)
+		return
+	}
+}
+
+func TestLoadMasterJsonRejectsBaseUrlForRemoteInput(t *testing.T) {
+	baseUrl = "https://example.com/video/1/master.json"
+	defer func() {
+		baseUrl = ""
+	}()
+
+	_, _, err := loadMasterJson(context.Background(), vimeo.NewClient(), "https://example.com/video/1/master.json")
+	expected := "--base-url is only for a saved master.json"
+	if err == nil || err.Error() != expected {
+		t.Errorf("loadMasterJson error does not match.\nexpected: %v\nactual:   %v", expected, err)
+		return
+	}
+}
+
+func TestLoadMasterJsonWithMissingFile(t *testing.T) {
+	_, _, err := loadMasterJson(context.Background(), vimeo.NewClient(), filepath.Join(t.TempDir(), "missing.json"))
+	if !os.IsNotExist(err) {
+		t.Errorf("loadMasterJson must fail for a missing file: %v", err)
+		return
+	}
+}
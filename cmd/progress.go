@@ -0,0 +1,269 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akiomik/vimeo-dl/vimeo"
+)
+
+const (
+	progressBarWidth     = 30
+	progressBarInterval  = 100 * time.Millisecond
+	progressLineInterval = 5 * time.Second
+)
+
+var (
+	quiet   bool
+	verbose bool
+)
+
+// progress reports the download of a single track, either as a bar which is
+// redrawn in place on a terminal, or as a line every progressLineInterval.
+// It is fed by the hooks of the client.
+type progress struct {
+	mu       sync.Mutex
+	out      io.Writer
+	live     bool
+	name     string
+	segments int
+	size     int64
+	now      func() time.Time
+	started  time.Time
+	printed  time.Time
+	finished bool
+
+	// done and written include a resumed part, while startSegments and
+	// receivedBytes exclude it from the rates
+	done          int
+	written       int64
+	startSegments int
+	receivedBytes int64
+}
+
+func newProgress(name string, segments int, size int64, state *vimeo.TrackState) *progress {
+	return &progress{
+		out:           os.Stdout,
+		live:          useProgressBar(),
+		name:          name,
+		segments:      segments,
+		size:          size,
+		now:           time.Now,
+		started:       time.Now(),
+		done:          state.Segments,
+		written:       state.Offset,
+		startSegments: state.Segments,
+	}
+}
+
+// useProgressBar reports whether a live bar can be drawn. Parallel batch
+// jobs and verbose messages would be mixed up with it, so lines are used.
+func useProgressBar() bool {
+	if verbose || (len(batchFile) > 0 && batchJobs > 1) {
+		return false
+	}
+
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// progressHooks returns client hooks which print messages, and the progress
+// of the track which is being downloaded. prefix is put before every line,
+// e.g. to tell parallel batch jobs apart.
+func progressHooks(prefix string) vimeo.Hooks {
+	var mu sync.Mutex
+	var current *progress
+	track := func() *progress {
+		mu.Lock()
+		defer mu.Unlock()
+		return current
+	}
+
+	// messages go through the progress so that they do not break a live bar
+	message := func(line string) {
+		line = prefix + line
+		if p := track(); p != nil {
+			p.message(line)
+		} else {
+			printInfo(line)
+		}
+	}
+
+	return vimeo.Hooks{
+		TrackStarted: func(e vimeo.TrackEvent, state vimeo.TrackState) {
+			mu.Lock()
+			defer mu.Unlock()
+			current = newProgress(prefix+e.Type, e.Segments, e.EstimatedSize, &state)
+		},
+		SegmentStarted: func(e vimeo.SegmentEvent) {
+			if verbose {
+				message("Downloading " + e.Url)
+			}
+		},
+		BytesReceived: func(e vimeo.SegmentEvent, n int) {
+			track().received(n)
+		},
+		SegmentFinished: func(e vimeo.SegmentEvent, size int64) {
+			track().segmentFinished(e.Index, size)
+		},
+		Retry: func(e vimeo.RetryEvent) {
+			message(fmt.Sprintf("Retrying %s in %v (attempt %d/%d): %v", e.Description, e.Delay.Round(time.Millisecond), e.Attempt, e.MaxAttempts, e.Err))
+		},
+		Error: func(vimeo.TrackEvent, error) {
+			track().finish()
+		},
+		Completed: func(vimeo.TrackEvent) {
+			track().finish()
+		},
+		Info: message,
+	}
+}
+
+func (p *progress) received(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.receivedBytes += int64(n)
+	p.print(false)
+}
+
+func (p *progress) segmentFinished(index int, size int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.done = index + 1
+	p.written += size
+	p.print(false)
+}
+
+// message prints a line without breaking a live bar.
+func (p *progress) message(line string) {
+	if quiet {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.live && !p.printed.IsZero() && !p.finished {
+		fmt.Fprint(p.out, "\r\x1b[K"+line+"\n")
+		p.print(true)
+		return
+	}
+
+	fmt.Fprintln(p.out, line)
+}
+
+// finish prints the final state, and ends the line of a live bar.
+func (p *progress) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.finished {
+		return
+	}
+
+	p.print(true)
+	if p.live && !quiet {
+		fmt.Fprintln(p.out)
+	}
+	p.finished = true
+}
+
+// print draws the progress unless it was drawn within the interval. The
+// caller must hold p.mu.
+func (p *progress) print(force bool) {
+	if quiet || p.finished {
+		return
+	}
+
+	interval := progressLineInterval
+	if p.live {
+		interval = progressBarInterval
+	}
+	if !force && p.now().Sub(p.printed) < interval {
+		return
+	}
+
+	p.printed = p.now()
+	if p.live {
+		fmt.Fprint(p.out, "\r"+p.String()+"\x1b[K")
+	} else {
+		fmt.Fprintln(p.out, p.String())
+	}
+}
+
+func (p *progress) String() string {
+	fraction := 0.0
+	if p.segments > 0 {
+		fraction = float64(p.done) / float64(p.segments)
+	}
+
+	elapsed := p.now().Sub(p.started)
+	throughput := 0.0
+	if elapsed > 0 {
+		throughput = float64(p.receivedBytes) / elapsed.Seconds()
+	}
+
+	size := formatSize(p.written)
+	if p.size > 0 {
+		size += "/~" + formatSize(p.size)
+	}
+
+	stats := fmt.Sprintf("%3.0f%% %d/%d segments  %s  %s/s  ETA %s",
+		fraction*100, p.done, p.segments, size, formatSize(int64(throughput)), p.eta(elapsed, throughput))
+	if p.live {
+		filled := int(fraction * progressBarWidth)
+		bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+		return fmt.Sprintf("%-5s [%s] %s", p.name, bar, stats)
+	}
+
+	return fmt.Sprintf("%-5s %s", p.name, stats)
+}
+
+// eta estimates the remaining time from the estimated size, or from the
+// number of remaining segments when the size is unknown.
+func (p *progress) eta(elapsed time.Duration, throughput float64) string {
+	remaining := p.segments - p.done
+	if remaining <= 0 {
+		return formatDuration(0)
+	}
+
+	segmentsDone := p.done - p.startSegments
+	if segmentsDone <= 0 {
+		return "-"
+	}
+
+	if p.size > p.written && throughput > 0 {
+		return formatDuration(time.Duration(float64(p.size-p.written) / throughput * float64(time.Second)))
+	}
+
+	return formatDuration(elapsed / time.Duration(segmentsDone) * time.Duration(remaining))
+}
+
+func formatDuration(d time.Duration) string {
+	seconds := int(d.Round(time.Second).Seconds())
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
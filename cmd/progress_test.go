@@ -0,0 +1,184 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+const mib = 1024 * 1024
+
+// newTestProgress returns a progress which started at a fixed time and
+// whose clock is advanced by the returned func.
+func newTestProgress(name string, segments int, size int64, live bool) (*progress, *bytes.Buffer, func(time.Duration)) {
+	started := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := started
+	out := new(bytes.Buffer)
+	p := &progress{
+		out:      out,
+		live:     live,
+		name:     name,
+		segments: segments,
+		size:     size,
+		now:      func() time.Time { return now },
+		started:  started,
+	}
+
+	return p, out, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestProgressString(t *testing.T) {
+	tests := []struct {
+		name          string
+		live          bool
+		segments      int
+		size          int64
+		done          int
+		written       int64
+		startSegments int
+		receivedBytes int64
+		elapsed       time.Duration
+		expected      string
+	}{
+		// ETA from the estimated size and the throughput
+		{"video", false, 10, 10 * mib, 5, 5 * mib, 0, 5 * mib, 10 * time.Second, "video  50% 5/10 segments  5.0MiB/~10.0MiB  512.0KiB/s  ETA 0:10"},
+		// ETA from the segments of this run when the size is unknown
+		{"audio", false, 10, 0, 6, 6 * mib, 4, 2 * mib, 20 * time.Second, "audio  60% 6/10 segments  6.0MiB  102.4KiB/s  ETA 0:40"},
+		// ETA from the segments when more than the estimated size is written
+		{"video", false, 4, mib, 2, 2 * mib, 0, 2 * mib, 30 * time.Second, "video  50% 2/4 segments  2.0MiB/~1.0MiB  68.3KiB/s  ETA 0:30"},
+		// no ETA before a segment of this run is finished
+		{"video", false, 10, 10 * mib, 4, 4 * mib, 4, 0, time.Second, "video  40% 4/10 segments  4.0MiB/~10.0MiB  -/s  ETA -"},
+		{"video", false, 10, 10 * mib, 10, 10 * mib, 0, 10 * mib, 2 * time.Hour, "video 100% 10/10 segments  10.0MiB/~10.0MiB  1.4KiB/s  ETA 0:00"},
+		{"video", false, 0, 0, 0, 0, 0, 0, 0, "video   0% 0/0 segments  -  -/s  ETA 0:00"},
+		{"[1/2] video", false, 10, 0, 1, 512, 0, 512, 3 * time.Hour, "[1/2] video  10% 1/10 segments  512B  -/s  ETA 27:00:00"},
+		{"video", true, 10, 10 * mib, 5, 5 * mib, 0, 5 * mib, 10 * time.Second, "video [===============               ]  50% 5/10 segments  5.0MiB/~10.0MiB  512.0KiB/s  ETA 0:10"},
+		{"audio", true, 3, 0, 3, 3 * mib, 0, 3 * mib, 3 * time.Second, "audio [==============================] 100% 3/3 segments  3.0MiB  1.0MiB/s  ETA 0:00"},
+	}
+
+	for _, test := range tests {
+		p, _, advance := newTestProgress(test.name, test.segments, test.size, test.live)
+		p.done = test.done
+		p.written = test.written
+		p.startSegments = test.startSegments
+		p.receivedBytes = test.receivedBytes
+		advance(test.elapsed)
+
+		actual := p.String()
+		if actual != test.expected {
+			t.Errorf("progress.String does not match.\nexpected: %v\nactual:   %v", test.expected, actual)
+			return
+		}
+	}
+}
+
+func TestProgressPrintsLinesEveryInterval(t *testing.T) {
+	p, out, advance := newTestProgress("video", 4, 0, false)
+
+	p.received(100)
+	advance(time.Second)
+	p.received(100)
+	p.segmentFinished(0, 200)
+	advance(progressLineInterval)
+	p.received(100)
+	p.finish()
+	p.finish()
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	expected := []string{
+		"video   0% 0/4 segments  -  -/s  ETA -",
+		"video  25% 1/4 segments  200B  50B/s  ETA 0:18",
+		"video  25% 1/4 segments  200B  50B/s  ETA 0:18",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("progress lines do not match.\nexpected: %q\nactual:   %q", expected, lines)
+		return
+	}
+}
+
+func TestProgressRedrawsLiveBar(t *testing.T) {
+	p, out, advance := newTestProgress("audio", 2, 0, true)
+
+	p.received(100)
+	advance(progressBarInterval / 2)
+	p.received(100)
+	p.message("Retrying")
+	advance(progressBarInterval)
+	p.segmentFinished(0, 200)
+	p.finish()
+
+	expected := "\raudio [                              ]   0% 0/2 segments  -  -/s  ETA -\x1b[K" +
+		"\r\x1b[KRetrying\n" +
+		"\raudio [                              ]   0% 0/2 segments  -  3.9KiB/s  ETA -\x1b[K" +
+		"\raudio [===============               ]  50% 1/2 segments  200B  1.3KiB/s  ETA 0:00\x1b[K" +
+		"\raudio [===============               ]  50% 1/2 segments  200B  1.3KiB/s  ETA 0:00\x1b[K\n"
+	if out.String() != expected {
+		t.Errorf("progress bar does not match.\nexpected: %q\nactual:   %q", expected, out.String())
+		return
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		input    int64
+		expected string
+	}{
+		{-1, "-"},
+		{0, "-"},
+		{1, "1B"},
+		{1023, "1023B"},
+		{1024, "1.0KiB"},
+		{1536, "1.5KiB"},
+		{5 * mib, "5.0MiB"},
+		{3 << 30, "3.0GiB"},
+		{2 << 40, "2.0TiB"},
+		{1 << 50, "1024.0TiB"},
+	}
+
+	for _, test := range tests {
+		actual := formatSize(test.input)
+		if actual != test.expected {
+			t.Errorf("formatSize(%d) does not match.\nexpected: %v\nactual:   %v", test.input, test.expected, actual)
+			return
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		input    time.Duration
+		expected string
+	}{
+		{0, "0:00"},
+		{400 * time.Millisecond, "0:00"},
+		{59 * time.Second, "0:59"},
+		{59500 * time.Millisecond, "1:00"},
+		{90 * time.Second, "1:30"},
+		{59*time.Minute + 59*time.Second, "59:59"},
+		{time.Hour, "1:00:00"},
+		{time.Hour + 2*time.Minute + 3*time.Second, "1:02:03"},
+		{100 * time.Hour, "100:00:00"},
+	}
+
+	for _, test := range tests {
+		actual := formatDuration(test.input)
+		if actual != test.expected {
+			t.Errorf("formatDuration(%v) does not match.\nexpected: %v\nactual:   %v", test.input, test.expected, actual)
+			return
+		}
+	}
+}
@@ -15,11 +15,13 @@
 package cmd
 
 import (
-	"encoding/base64"
+	"context"
+	"errors"
 	"fmt"
-	"net/url"
 	"os"
-	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/akiomik/vimeo-dl/config"
 	"github.com/akiomik/vimeo-dl/vimeo"
@@ -27,155 +29,170 @@ import (
 )
 
 var (
-	input          string
-	userAgent      string
-	videoId        string
-	audioId        string
-	outputFilename string
-	combine        bool
+	input            string
+	userAgent        string
+	videoId          string
+	audioId          string
+	formatSelector   string
+	startTime        string
+	endTime          string
+	rebaseTimestamps bool
+	outputFilename   string
+	outputTemplate   string
+	outputDir        string
+	combine          bool
+	concurrency      int
+	maxAttempts      int
+	retryDelay       time.Duration
+	retryMaxDelay    time.Duration
+	retryStatuses    []int
+	resume           bool
+	rangeHeader      bool
+	downloadArchive  string
+	overwrite        bool
+	noOverwrite      bool
+	skipExisting     bool
 )
 
+var archive *vimeo.Archive
+
 var rootCmd = &cobra.Command{
 	Use:     "vimeo-dl",
 	Short:   "vimeo-dl " + config.Version,
 	Version: config.Version,
 	Run: func(cmd *cobra.Command, args []string) {
-		client := vimeo.NewClient()
-		if len(userAgent) > 0 {
-			client.UserAgent = userAgent
-		}
-
-		masterJsonUrl, err := url.Parse(input)
-		if err != nil {
-			fmt.Println("Error:", err.Error())
-			os.Exit(1)
-		}
+		ctx, stop := notifyContext()
+		defer stop()
 
-		masterJson, err := client.GetMasterJson(masterJsonUrl)
-		if err != nil {
-			fmt.Println("Error:", err.Error())
-			os.Exit(1)
-		}
-
-		if outputFilename == "" {
-			outputFilename = masterJson.ClipId
-		}
-
-		videoOutputFilename := outputFilename + "-video.mp4"
-		err = createVideo(client, masterJson, masterJsonUrl, videoOutputFilename)
-		if err != nil {
-			fmt.Println("Error:", err.Error())
-
-			if _, ok := err.(base64.CorruptInputError); ok {
-				query := masterJsonUrl.Query()
-				query.Add("base64_init", "1")
-				query.Del("query_string_ranges")
-				masterJsonUrl.RawQuery = query.Encode()
-				fmt.Println("Try this url:", masterJsonUrl.String())
-			}
-
-			os.Exit(1)
-		}
-
-		if len(masterJson.Audio) > 0 {
-			audioOutputFilename := outputFilename + "-audio.mp4"
-			err = createAudio(client, masterJson, masterJsonUrl, audioOutputFilename)
+		if len(downloadArchive) > 0 {
+			var err error
+			archive, err = vimeo.OpenArchive(downloadArchive)
 			if err != nil {
-				fmt.Println("Error:", err.Error())
+				printError(err)
 				os.Exit(1)
 			}
+		}
 
-			if combine {
-				outputFilename := outputFilename + ".mp4"
-				err = combineVideoAndAudio(videoOutputFilename, audioOutputFilename, outputFilename)
-				if err != nil {
-					fmt.Println("Error:", err.Error())
-					os.Exit(1)
-				}
+		if len(batchFile) > 0 {
+			err := runBatch(ctx, batchFile)
+			if err != nil {
+				exitWithError(err)
 			}
+			return
 		}
 
-		fmt.Println("Done!")
+		j := &job{
+			input:          input,
+			outputFilename: outputFilename,
+			videoId:        videoId,
+			audioId:        audioId,
+		}
+		err := download(ctx, newClient(), j)
+		if err != nil {
+			exitWithError(err)
+		}
 	},
 }
 
 func init() {
-	rootCmd.Flags().StringVarP(&input, "input", "i", "", "url for master.json (required)")
+	addInputFlags(rootCmd)
+	rootCmd.Flags().StringVarP(&batchFile, "batch-file", "", "", "file with a url (and optionally an output name and ids) per line, or - for stdin")
+	rootCmd.Flags().IntVarP(&batchJobs, "jobs", "j", 1, "number of batch jobs to run in parallel")
 	rootCmd.Flags().StringVarP(&userAgent, "user-agent", "", "", "user-agent for request")
 	rootCmd.Flags().StringVarP(&videoId, "video-id", "", "", "video id")
 	rootCmd.Flags().StringVarP(&audioId, "audio-id", "", "", "audio id")
+	rootCmd.Flags().StringVarP(&formatSelector, "format", "f", "", "format selector, e.g. 'bestvideo[height<=720]+bestaudio' (see README)")
+	rootCmd.Flags().StringVarP(&startTime, "start", "", "", "start of the time range to download, e.g. 1:02:03 or 90")
+	rootCmd.Flags().StringVarP(&endTime, "end", "", "", "end of the time range to download")
+	rootCmd.Flags().BoolVarP(&rebaseTimestamps, "rebase-timestamps", "", false, "make a time range start at zero")
 	rootCmd.Flags().StringVarP(&outputFilename, "output-file-name", "o", "", "output file name")
-	rootCmd.Flags().BoolVarP(&combine, "combine", "", false, "combine video and audio into a single mp4 (ffmpeg is required)")
-	rootCmd.MarkFlagRequired("input")
+	rootCmd.Flags().StringVarP(&outputTemplate, "output", "", "", "output file name template, e.g. %(clip_id)s/%(height)sp-%(video_id)s.%(ext)s")
+	rootCmd.Flags().StringVarP(&outputDir, "output-dir", "", ".", "directory to write outputs to; names from --output outside of it are rejected")
+	rootCmd.Flags().BoolVarP(&combine, "combine", "", false, "combine video and audio into a single mp4")
+	rootCmd.Flags().IntVarP(&concurrency, "concurrency", "c", 4, "number of segments to download concurrently")
+	defaultRetry := vimeo.DefaultRetryPolicy()
+	rootCmd.Flags().IntVarP(&maxAttempts, "max-attempts", "", defaultRetry.MaxAttempts, "maximum number of attempts for each request")
+	rootCmd.Flags().DurationVarP(&retryDelay, "retry-delay", "", defaultRetry.BaseDelay, "initial delay between retries (doubled on each retry)")
+	rootCmd.Flags().DurationVarP(&retryMaxDelay, "retry-max-delay", "", defaultRetry.MaxDelay, "maximum delay between retries")
+	rootCmd.Flags().IntSliceVarP(&retryStatuses, "retry-status-codes", "", defaultRetry.RetryableStatusCodes, "http status codes to retry")
+	rootCmd.Flags().BoolVarP(&rangeHeader, "range-header", "", false, "request byte ranges with the Range header instead of a range query")
+	rootCmd.Flags().StringVarP(&downloadArchive, "download-archive", "", "", "skip clips listed in this file, and record downloaded clips in it")
+	rootCmd.Flags().BoolVarP(&overwrite, "overwrite", "", false, "replace existing outputs")
+	rootCmd.Flags().BoolVarP(&noOverwrite, "no-overwrite", "", false, "fail if an output exists (default)")
+	rootCmd.Flags().BoolVarP(&skipExisting, "skip-existing", "", false, "skip clips whose outputs exist")
+	rootCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "print only errors")
+	rootCmd.Flags().BoolVar(&verbose, "verbose", false, "print the url of every segment")
+	rootCmd.Flags().BoolVarP(&resume, "resume", "", false, "resume an interrupted download from its state file")
+	rootCmd.MarkFlagsOneRequired("input", "player-config", "har", "batch-file")
+	rootCmd.MarkFlagsMutuallyExclusive("input", "player-config", "har", "batch-file")
+	rootCmd.MarkFlagsMutuallyExclusive("batch-file", "output-file-name")
+	rootCmd.MarkFlagsMutuallyExclusive("output", "output-file-name")
+	rootCmd.MarkFlagsMutuallyExclusive("overwrite", "no-overwrite", "skip-existing")
+	rootCmd.MarkFlagsMutuallyExclusive("quiet", "verbose")
+	rootCmd.MarkFlagsMutuallyExclusive("format", "video-id")
+	rootCmd.MarkFlagsMutuallyExclusive("format", "audio-id")
 }
 
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println("Error:", err.Error())
+		printError(err)
 		os.Exit(1)
 	}
 }
 
-func createVideo(client *vimeo.Client, masterJson *vimeo.MasterJson, masterJsonUrl *url.URL, outputFilename string) error {
-	videoFile, err := os.OpenFile(outputFilename, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
-	if err != nil {
-		return err
-	}
-	defer videoFile.Close()
-	fmt.Println("Downloading to " + outputFilename)
-
-	if len(videoId) == 0 {
-		videoId = masterJson.FindMaximumBitrateVideo().Id
+func newClient() *vimeo.Client {
+	client := vimeo.NewClient()
+	if len(userAgent) > 0 {
+		client.UserAgent = userAgent
 	}
-
-	err = masterJson.CreateVideoFile(videoFile, masterJsonUrl, videoId, client)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	client.Concurrency = concurrency
+	client.RangeHeader = rangeHeader
+	client.Hooks = progressHooks("")
+	client.Retry.MaxAttempts = maxAttempts
+	client.Retry.BaseDelay = retryDelay
+	client.Retry.MaxDelay = retryMaxDelay
+	client.Retry.RetryableStatusCodes = retryStatuses
+
+	return client
 }
 
-func createAudio(client *vimeo.Client, masterJson *vimeo.MasterJson, masterJsonUrl *url.URL, outputFilename string) error {
-	audioFile, err := os.OpenFile(outputFilename, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
-	if err != nil {
-		return err
-	}
-	defer audioFile.Close()
-	fmt.Println("Downloading to " + outputFilename)
-
-	if len(audioId) == 0 {
-		audioId = masterJson.FindMaximumBitrateAudio().Id
-	}
-
-	err = masterJson.CreateAudioFile(audioFile, masterJsonUrl, audioId, client)
-	if err != nil {
-		return err
+// printInfo prints a message unless --quiet is set.
+func printInfo(a ...interface{}) {
+	if !quiet {
+		fmt.Println(a...)
 	}
+}
 
-	return nil
+// notifyContext returns a context which is canceled on SIGINT or SIGTERM.
+// Once it is canceled, the signals are no longer caught, so that a second
+// one terminates the process immediately.
+func notifyContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	return ctx, stop
 }
 
-func combineVideoAndAudio(videoFilename string, audioFilename string, outputFilename string) error {
-	err := exec.Command("ffmpeg", "-version").Run()
-	if err != nil {
-		return err
+// exitWithError prints err and exits. An interrupted download keeps its part
+// and state files, so it only tells how to continue.
+func exitWithError(err error) {
+	if errors.Is(err, context.Canceled) {
+		fmt.Println("Interrupted. Run again with --resume to continue.")
+		os.Exit(130)
 	}
 
-	err = exec.Command("ffmpeg", "-i", videoFilename, "-i", audioFilename, "-c", "copy", outputFilename).Run()
-	if err != nil {
-		return err
-	}
+	printError(err)
+	os.Exit(1)
+}
 
-	err = os.Remove(videoFilename)
-	if err != nil {
-		return err
-	}
+func printError(err error) {
+	fmt.Println("Error:", err.Error())
 
-	err = os.Remove(audioFilename)
-	if err != nil {
-		return err
+	var httpErr *vimeo.HTTPError
+	if errors.As(err, &httpErr) && len(httpErr.Body) > 0 {
+		fmt.Println("Response:", httpErr.Body)
 	}
-
-	return nil
 }
@@ -0,0 +1,94 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseTimestamp parses [[hh:]mm:]ss[.fff], plain seconds or a Go duration
+// such as 1h2m3s, and returns seconds.
+func parseTimestamp(s string) (float64, error) {
+	if strings.Contains(s, ":") {
+		parts := strings.Split(s, ":")
+		if len(parts) > 3 {
+			return 0, fmt.Errorf("invalid timestamp '%s'", s)
+		}
+
+		var seconds float64
+		for i, part := range parts {
+			v, err := strconv.ParseFloat(part, 64)
+			if err != nil || !isFinite(v) || v < 0 || (i > 0 && v >= 60) || (i < len(parts)-1 && strings.Contains(part, ".")) {
+				return 0, fmt.Errorf("invalid timestamp '%s'", s)
+			}
+			seconds = seconds*60 + v
+		}
+
+		return seconds, nil
+	}
+
+	seconds, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timestamp '%s'", s)
+		}
+		seconds = d.Seconds()
+	}
+
+	if !isFinite(seconds) || seconds < 0 {
+		return 0, fmt.Errorf("invalid timestamp '%s'", s)
+	}
+
+	return seconds, nil
+}
+
+// isFinite rejects NaN and Inf, which strconv.ParseFloat accepts.
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// parseTimeRange parses --start and --end into seconds, where zero means
+// unset.
+func parseTimeRange() (float64, float64, error) {
+	if len(startTime) == 0 && len(endTime) == 0 {
+		if rebaseTimestamps {
+			return 0, 0, errors.New("--rebase-timestamps requires --start or --end")
+		}
+		return 0, 0, nil
+	}
+
+	var start, end float64
+	var err error
+	if len(startTime) > 0 {
+		start, err = parseTimestamp(startTime)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	if len(endTime) > 0 {
+		end, err = parseTimestamp(endTime)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return start, end, nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"testing"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"0", 0},
+		{"90", 90},
+		{"90.5", 90.5},
+		{"1:30", 90},
+		{"1:59.5", 119.5},
+		{"0:59", 59},
+		{"1:00:00", 3600},
+		{"01:02:03", 3723},
+		{"100:00", 6000},
+		{"1h2m3s", 3723},
+		{"1.5s", 1.5},
+		{"500ms", 0.5},
+	}
+
+	for _, test := range tests {
+		actual, err := parseTimestamp(test.input)
+		if err != nil {
+			t.Errorf("parseTimestamp(%q) failed: %v", test.input, err)
+			return
+		}
+
+		if actual != test.expected {
+			t.Errorf("parseTimestamp(%q) does not match.\nexpected: %v\nactual:   %v", test.input, test.expected, actual)
+			return
+		}
+	}
+}
+
+func TestParseTimestampRejectsInvalidInputs(t *testing.T) {
+	inputs := []string{
+		"",
+		"abc",
+		"-1",
+		"-1h",
+		"1:60",
+		"1:00:60",
+		"1:-1",
+		"1.5:00",
+		"1:2:3:4",
+		":30",
+		"1:",
+		"NaN",
+		"Inf",
+		"1:NaN",
+	}
+
+	for _, input := range inputs {
+		_, err := parseTimestamp(input)
+		if err == nil {
+			t.Errorf("parseTimestamp(%q) must fail", input)
+			return
+		}
+	}
+}
@@ -33,11 +33,6 @@
             inherit version;
             src = ./.;
             vendorHash = "sha256-hocnLCzWN8srQcO3BMNkd2lt0m54Qe7sqAhUxVZlz1k=";
-            nativeBuildInputs = with pkgs; [ makeWrapper ];
-            postInstall = ''
-              wrapProgram $out/bin/${pname} \
-                --prefix PATH : ${pkgs.lib.makeBinPath [ pkgs.ffmpeg ]}
-            '';
           };
         });
     };
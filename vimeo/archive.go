@@ -0,0 +1,132 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vimeo
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ArchiveEntry is a completed download recorded in an Archive.
+type ArchiveEntry struct {
+	ClipId  string
+	VideoId string
+	AudioId string
+}
+
+func (e *ArchiveEntry) String() string {
+	return strings.TrimSpace(e.ClipId + " " + e.VideoId + " " + e.AudioId)
+}
+
+// Archive is a download archive: a text file with a line of
+// "<clip_id> <video_id> [<audio_id>]" for each completed download. It is safe
+// for concurrent use.
+type Archive struct {
+	filename string
+	mu       sync.Mutex
+	entries  []ArchiveEntry
+}
+
+// OpenArchive loads the archive from filename. A missing file is an empty
+// archive, which is created on the first Add.
+func OpenArchive(filename string) (*Archive, error) {
+	archive := &Archive{filename: filename, entries: []ArchiveEntry{}}
+
+	file, err := os.Open(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return archive, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 3 {
+			return nil, fmt.Errorf("%s:%d: invalid archive entry", filename, n)
+		}
+
+		entry := ArchiveEntry{ClipId: fields[0]}
+		if len(fields) > 1 {
+			entry.VideoId = fields[1]
+		}
+		if len(fields) > 2 {
+			entry.AudioId = fields[2]
+		}
+		archive.entries = append(archive.entries, entry)
+	}
+
+	return archive, scanner.Err()
+}
+
+// Contains reports whether the clip was downloaded. Empty ids match any
+// rendition.
+func (a *Archive) Contains(clipId string, videoId string, audioId string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, e := range a.entries {
+		if e.ClipId == clipId && (len(videoId) == 0 || videoId == e.VideoId) && (len(audioId) == 0 || audioId == e.AudioId) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Add records a completed download and appends it to the file.
+func (a *Archive) Add(entry ArchiveEntry) error {
+	valid := len(entry.ClipId) > 0 && (len(entry.VideoId) > 0 || len(entry.AudioId) == 0)
+	for _, field := range []string{entry.ClipId, entry.VideoId, entry.AudioId} {
+		if strings.ContainsAny(field, " \t\r\n") {
+			valid = false
+		}
+	}
+	if !valid {
+		return fmt.Errorf("invalid archive entry %q", entry.String())
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	file, err := os.OpenFile(a.filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(file, entry.String())
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+
+	a.entries = append(a.entries, entry)
+	return nil
+}
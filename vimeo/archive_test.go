@@ -0,0 +1,96 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vimeo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestArchiveAddAndContains(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "archive.txt")
+
+	archive, err := OpenArchive(filename)
+	if err != nil {
+		t.Errorf("OpenArchive failed: %v", err)
+		return
+	}
+
+	if archive.Contains("foo", "", "") {
+		t.Errorf("Contains must be false for an empty archive")
+	}
+
+	err = archive.Add(ArchiveEntry{ClipId: "foo", VideoId: "1080p", AudioId: "bar"})
+	if err != nil {
+		t.Errorf("Add failed: %v", err)
+		return
+	}
+	err = archive.Add(ArchiveEntry{ClipId: "baz", VideoId: "720p"})
+	if err != nil {
+		t.Errorf("Add failed: %v", err)
+		return
+	}
+
+	expected := "foo 1080p bar\nbaz 720p\n"
+	actual, _ := os.ReadFile(filename)
+	if string(actual) != expected {
+		t.Errorf("Add output does not match.\nexpected: %q\nactual:   %q", expected, actual)
+	}
+
+	reopened, err := OpenArchive(filename)
+	if err != nil {
+		t.Errorf("OpenArchive failed: %v", err)
+		return
+	}
+
+	cases := []struct {
+		clipId   string
+		videoId  string
+		audioId  string
+		expected bool
+	}{
+		{"foo", "", "", true},
+		{"foo", "1080p", "bar", true},
+		{"foo", "720p", "", false},
+		{"baz", "720p", "", true},
+		{"baz", "", "bar", false},
+		{"qux", "", "", false},
+	}
+
+	for _, c := range cases {
+		if reopened.Contains(c.clipId, c.videoId, c.audioId) != c.expected {
+			t.Errorf("Contains(%v, %v, %v) must be %v", c.clipId, c.videoId, c.audioId, c.expected)
+		}
+	}
+}
+
+func TestArchiveAddWithInvalidEntry(t *testing.T) {
+	archive, _ := OpenArchive(filepath.Join(t.TempDir(), "archive.txt"))
+
+	entries := []ArchiveEntry{
+		ArchiveEntry{ClipId: ""},
+		ArchiveEntry{ClipId: "foo\nbar"},
+		ArchiveEntry{ClipId: "foo", VideoId: "1080p bar"},
+		ArchiveEntry{ClipId: "foo", AudioId: "bar"},
+	}
+
+	for _, entry := range entries {
+		err := archive.Add(entry)
+		if err == nil {
+			t.Errorf("Add must fail for %q", entry.String())
+		}
+	}
+}
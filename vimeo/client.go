@@ -15,7 +15,8 @@
 package vimeo
 
 import (
-	"encoding/json"
+	"bytes"
+	"context"
 	"io"
 	"net/http"
 	"net/url"
@@ -24,56 +25,152 @@ import (
 )
 
 type Client struct {
-	Client    *http.Client
-	UserAgent string
+	Client      *http.Client
+	UserAgent   string
+	Concurrency int
+	Retry       RetryPolicy
+
+	// Header is added to every request, e.g. Referer and Cookie.
+	Header http.Header
+
+	// RangeHeader makes requests with a range query (byte ranges of
+	// master.json) use the Range header instead.
+	RangeHeader bool
+
+	// Hooks are called as segments are downloaded.
+	Hooks Hooks
 }
 
 func NewClient() *Client {
 	client := Client{}
 	client.Client = http.DefaultClient
 	client.UserAgent = "vimeo-dl/" + config.Version
+	client.Concurrency = 1
+	client.Retry = DefaultRetryPolicy()
 
 	return &client
 }
 
-func (c *Client) get(url *url.URL) (*http.Response, error) {
-	req, err := http.NewRequest("GET", url.String(), nil)
+func (c *Client) get(ctx context.Context, url *url.URL) (*http.Response, error) {
+	requestUrl := url
+	byteRange := ""
+	if c.RangeHeader {
+		query := url.Query()
+		byteRange = query.Get("range")
+		if len(byteRange) > 0 {
+			query.Del("range")
+			rangeless := *url
+			rangeless.RawQuery = query.Encode()
+			requestUrl = &rangeless
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", requestUrl.String(), nil)
 	if err != nil {
 		return nil, err
 	}
+	for name, values := range c.Header {
+		req.Header[name] = values
+	}
 	req.Header.Set("User-Agent", c.UserAgent)
+	if len(byteRange) > 0 {
+		req.Header.Set("Range", "bytes="+byteRange)
+	}
 
 	res, err := c.Client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		defer res.Body.Close()
+		return nil, newHTTPError(url.String(), res)
+	}
+
+	if len(byteRange) > 0 && res.StatusCode != http.StatusPartialContent {
+		res.Body.Close()
+		return nil, &ProtocolError{Url: url.String(), Message: "the server ignored the Range header"}
+	}
+
 	return res, nil
 }
 
+// GetMasterJson fetches and decodes master.json. If it does not embed every
+// init segment, it is fetched again with base64_init=1, which makes the
+// server embed them. Init segments which are still missing are downloaded
+// from their urls later.
 func (c *Client) GetMasterJson(url *url.URL) (*MasterJson, error) {
-	res, err := c.get(url)
+	return c.GetMasterJsonContext(context.Background(), url)
+}
+
+// GetMasterJsonContext is GetMasterJson with a context, which cancels the
+// requests when it is done.
+func (c *Client) GetMasterJsonContext(ctx context.Context, url *url.URL) (*MasterJson, error) {
+	masterJson, err := c.getMasterJson(ctx, url)
 	if err != nil {
 		return nil, err
 	}
-	defer res.Body.Close()
 
-	jsonBlob, err := io.ReadAll(res.Body)
+	query := url.Query()
+	if masterJson.hasEmbeddedInitSegments() || query.Get("base64_init") == "1" {
+		return masterJson, nil
+	}
+
+	query.Set("base64_init", "1")
+	base64InitUrl := *url
+	base64InitUrl.RawQuery = query.Encode()
+
+	refetched, err := c.getMasterJson(ctx, &base64InitUrl)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return masterJson, nil
+	}
+
+	return refetched, nil
+}
+
+func (c *Client) getMasterJson(ctx context.Context, url *url.URL) (*MasterJson, error) {
+	var jsonBlob []byte
+	err := c.retry(ctx, "master.json", func() error {
+		res, err := c.get(ctx, url)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+
+		jsonBlob, err = io.ReadAll(res.Body)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	masterJson := new(MasterJson)
-	err = json.Unmarshal(jsonBlob, &masterJson)
+	return ParseMasterJson(jsonBlob)
+}
+
+// GetPlayerConfig fetches the config json of the Vimeo player, e.g.
+// https://player.vimeo.com/video/{id}/config.
+func (c *Client) GetPlayerConfig(url *url.URL) (*PlayerConfig, error) {
+	return c.GetPlayerConfigContext(context.Background(), url)
+}
+
+func (c *Client) GetPlayerConfigContext(ctx context.Context, url *url.URL) (*PlayerConfig, error) {
+	data, err := c.getBytes(ctx, "player config", url)
 	if err != nil {
 		return nil, err
 	}
 
-	return masterJson, nil
+	return ParsePlayerConfig(data)
 }
 
 func (c *Client) Download(url *url.URL, output io.Writer) error {
-	res, err := c.get(url)
+	return c.DownloadContext(context.Background(), url, output)
+}
+
+func (c *Client) DownloadContext(ctx context.Context, url *url.URL, output io.Writer) error {
+	res, err := c.get(ctx, url)
 	if err != nil {
 		return err
 	}
@@ -86,3 +183,17 @@ func (c *Client) Download(url *url.URL, output io.Writer) error {
 
 	return nil
 }
+
+// getBytes downloads url into memory, retrying as configured.
+func (c *Client) getBytes(ctx context.Context, description string, url *url.URL) ([]byte, error) {
+	body := new(bytes.Buffer)
+	err := c.retry(ctx, description, func() error {
+		body.Reset()
+		return c.DownloadContext(ctx, url, body)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return body.Bytes(), nil
+}
@@ -16,6 +16,8 @@ package vimeo
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/url"
 	"reflect"
@@ -117,3 +119,270 @@ func TestDownload(t *testing.T) {
 		return
 	}
 }
+
+func TestGetMasterJsonWithErrorStatus(t *testing.T) {
+	client := NewClient()
+	client.Client = NewMockClient(func(req *http.Request) *http.Response {
+		return NewMockReponseWithStatus(http.StatusForbidden, "Forbidden")
+	})
+
+	jsonUrl, _ := url.Parse("http://example.com/master.json")
+	_, err := client.GetMasterJson(jsonUrl)
+
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Errorf("GetMasterJson err must be HTTPError: %v", err)
+		return
+	}
+
+	expected := &HTTPError{StatusCode: http.StatusForbidden, Url: jsonUrl.String(), Body: "Forbidden"}
+	if !reflect.DeepEqual(expected, httpErr) {
+		t.Errorf("GetMasterJson error does not match.\nexpected: %v\nactual:   %v", expected, httpErr)
+		return
+	}
+}
+
+func TestDownloadWithErrorStatus(t *testing.T) {
+	client := NewClient()
+	client.Client = NewMockClient(func(req *http.Request) *http.Response {
+		return NewMockReponseWithStatus(http.StatusNotFound, "<html>Not Found</html>")
+	})
+
+	parcelUrl, _ := url.Parse("http://example.com/parcel/1080.mp4?range=0-100")
+	output := new(bytes.Buffer)
+	err := client.Download(parcelUrl, output)
+
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Download err must be HTTPError with 404: %v", err)
+		return
+	}
+
+	if output.Len() != 0 {
+		t.Errorf("Download must not write an error response: %v", output.Bytes())
+		return
+	}
+}
+
+func TestGetMasterJsonWithFullSchema(t *testing.T) {
+	body := `{
+    "clip_id": "foo",
+    "base_url": "../",
+    "unknown_top": true,
+    "video": [{
+      "id": "bar",
+      "base_url": "bar/chop/",
+      "format": "dash",
+      "mime_type": "video/mp4",
+      "codecs": "avc1.640028",
+      "bitrate": 4937000,
+      "avg_bitrate": 3016000,
+      "duration": 12.0,
+      "framerate": 29.97,
+      "width": 1920,
+      "height": 1080,
+      "max_segment_duration": 6,
+      "init_segment": "baz",
+      "index_segment": "../../../range/prot/bar.mp4?range=0-999",
+      "segments": [{
+        "start": 0,
+        "end": 6.0,
+        "url": "segment-1.m4s",
+        "size": 2262696
+      }]
+    }],
+    "audio": [{
+      "id": "qux",
+      "base_url": "../audio/qux/chop/",
+      "mime_type": "audio/mp4",
+      "codecs": "mp4a.40.2",
+      "bitrate": 128000,
+      "avg_bitrate": 128000,
+      "duration": 12.0,
+      "channels": 2,
+      "sample_rate": 48000,
+      "init_segment": "baz",
+      "segments": [{
+        "start": 0,
+        "end": 6.0,
+        "url": "segment-1.m4s",
+        "size": 96573,
+        "unknown_segment": "x"
+      }]
+    }]
+  }`
+	expected := &MasterJson{
+		ClipId:  "foo",
+		BaseUrl: "../",
+		Video: []Video{
+			Video{
+				Id:                 "bar",
+				BaseUrl:            "bar/chop/",
+				Format:             "dash",
+				MimeType:           "video/mp4",
+				Codecs:             "avc1.640028",
+				Bitrate:            4937000,
+				AvgBitrate:         3016000,
+				Duration:           12,
+				Framerate:          29.97,
+				Width:              1920,
+				Height:             1080,
+				MaxSegmentDuration: 6,
+				InitSegment:        "baz",
+				IndexSegment:       "../../../range/prot/bar.mp4?range=0-999",
+				Segments: []Segment{
+					Segment{Url: "segment-1.m4s", Start: 0, End: 6, Size: 2262696},
+				},
+			},
+		},
+		Audio: []Audio{
+			Audio{
+				Id:          "qux",
+				BaseUrl:     "../audio/qux/chop/",
+				MimeType:    "audio/mp4",
+				Codecs:      "mp4a.40.2",
+				Bitrate:     128000,
+				AvgBitrate:  128000,
+				Duration:    12,
+				Channels:    2,
+				SampleRate:  48000,
+				InitSegment: "baz",
+				Segments: []Segment{
+					Segment{
+						Url:   "segment-1.m4s",
+						Start: 0,
+						End:   6,
+						Size:  96573,
+						Extra: Extra{"unknown_segment": json.RawMessage(`"x"`)},
+					},
+				},
+			},
+		},
+		Extra: Extra{"unknown_top": json.RawMessage(`true`)},
+	}
+
+	client := NewClient()
+	client.Client = NewMockClient(func(req *http.Request) *http.Response {
+		return NewMockReponseFromString(body)
+	})
+
+	jsonUrl, _ := url.Parse("http://example.com/master.json")
+	actual, err := client.GetMasterJson(jsonUrl)
+	if err != nil {
+		t.Errorf("GetMasterJson request is failed: %v", err)
+		return
+	}
+
+	if !reflect.DeepEqual(*expected, *actual) {
+		t.Errorf("GetMasterJson response does not match.\nexpected: %v\nactual:   %v", *expected, *actual)
+		return
+	}
+}
+
+func TestDownloadWithRangeHeader(t *testing.T) {
+	expectedUrl := "http://example.com/parcel/1080.mp4?foo=bar"
+	expectedRange := "bytes=0-9"
+
+	client := NewClient()
+	client.RangeHeader = true
+	client.Client = NewMockClient(func(req *http.Request) *http.Response {
+		if req.URL.String() != expectedUrl || req.Header.Get("Range") != expectedRange {
+			t.Errorf("Download request does not match.\nexpected: %v %v\nactual:   %v %v", expectedUrl, expectedRange, req.URL, req.Header.Get("Range"))
+		}
+		return NewMockReponseWithStatus(http.StatusPartialContent, "0123456789")
+	})
+
+	parcelUrl, _ := url.Parse("http://example.com/parcel/1080.mp4?foo=bar&range=0-9")
+	output := new(bytes.Buffer)
+	err := client.Download(parcelUrl, output)
+	if err != nil {
+		t.Errorf("Download request is failed: %v", err)
+		return
+	}
+
+	if output.String() != "0123456789" {
+		t.Errorf("Download output does not match.\nexpected: %v\nactual:   %v", "0123456789", output.String())
+		return
+	}
+}
+
+func TestDownloadWithIgnoredRangeHeader(t *testing.T) {
+	client := NewClient()
+	client.RangeHeader = true
+	client.Client = NewMockClient(func(req *http.Request) *http.Response {
+		return NewMockReponseFromString("the whole file")
+	})
+
+	parcelUrl, _ := url.Parse("http://example.com/parcel/1080.mp4?range=0-9")
+	err := client.Download(parcelUrl, new(bytes.Buffer))
+	if err == nil {
+		t.Errorf("Download must fail when the Range header is ignored")
+	}
+}
+
+func TestGetMasterJsonRefetchesWithBase64Init(t *testing.T) {
+	jsonUrl, _ := url.Parse("http://example.com/master.json?query_string_ranges=1")
+	base64InitUrl := "http://example.com/master.json?base64_init=1&query_string_ranges=1"
+	requests := []string{}
+
+	client := NewClient()
+	client.Client = NewMockClient(func(req *http.Request) *http.Response {
+		requests = append(requests, req.URL.String())
+		if req.URL.String() == base64InitUrl {
+			return NewMockReponseFromString(`{"clip_id":"foo","video":[{"id":"bar","init_segment":"Zm9vYmFyYmF6cXV4Cg=="}]}`)
+		}
+		return NewMockReponseFromString(`{"clip_id":"foo","video":[{"id":"bar","init_segment":"bar.mp4?range=0-99"}]}`)
+	})
+
+	masterJson, err := client.GetMasterJson(jsonUrl)
+	if err != nil {
+		t.Errorf("GetMasterJson failed: %v", err)
+		return
+	}
+
+	if masterJson.Video[0].InitSegment != "Zm9vYmFyYmF6cXV4Cg==" {
+		t.Errorf("GetMasterJson must use the init segment of base64_init=1: %v", masterJson.Video[0].InitSegment)
+	}
+
+	expected := []string{jsonUrl.String(), base64InitUrl}
+	if !reflect.DeepEqual(expected, requests) {
+		t.Errorf("GetMasterJson requests do not match.\nexpected: %v\nactual:   %v", expected, requests)
+	}
+}
+
+func TestGetMasterJsonWithEmbeddedInitSegments(t *testing.T) {
+	requests := 0
+	client := NewClient()
+	client.Client = NewMockClient(func(req *http.Request) *http.Response {
+		requests++
+		return NewMockReponseFromString(`{"clip_id":"foo","video":[{"id":"bar","init_segment":"Zm9vYmFyYmF6cXV4Cg=="}]}`)
+	})
+
+	jsonUrl, _ := url.Parse("http://example.com/master.json")
+	_, err := client.GetMasterJson(jsonUrl)
+	if err != nil {
+		t.Errorf("GetMasterJson failed: %v", err)
+		return
+	}
+
+	if requests != 1 {
+		t.Errorf("GetMasterJson must not refetch embedded init segments: %d requests", requests)
+	}
+}
+
+func TestDownloadWithHeader(t *testing.T) {
+	client := NewClient()
+	client.Header = http.Header{"Referer": []string{"https://player.vimeo.com/"}}
+	client.Client = NewMockClient(func(req *http.Request) *http.Response {
+		if req.Header.Get("Referer") != "https://player.vimeo.com/" {
+			t.Errorf("Download request header does not match: %v", req.Header)
+		}
+		return NewMockReponseFromString("0123456789")
+	})
+
+	parcelUrl, _ := url.Parse("http://example.com/parcel/1080.mp4")
+	err := client.Download(parcelUrl, new(bytes.Buffer))
+	if err != nil {
+		t.Errorf("Download request is failed: %v", err)
+	}
+}
@@ -0,0 +1,434 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vimeo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DownloadOptions configure a Downloader. The zero value downloads the
+// highest bitrate video and audio to ${clip_id}-video.mp4 and
+// ${clip_id}-audio.mp4 in the current directory.
+type DownloadOptions struct {
+	// VideoId and AudioId choose the formats. Format is a selector (see
+	// ParseSelector) which is used when neither of them is set.
+	VideoId string
+	AudioId string
+	Format  string
+
+	// Start and End (in seconds) trim the clip to a time range, where zero
+	// means unset. RebaseTimestamps makes the range start at zero.
+	Start            float64
+	End              float64
+	RebaseTimestamps bool
+
+	// OutputFilename is the name of the outputs without an extension, which
+	// is relative to OutputDir unless it is absolute. If it is empty,
+	// OutputTemplate (see RenderTemplate) is rendered instead, which defaults
+	// to the clip id. A rendered name is confined to OutputDir, since its
+	// fields come from remote data.
+	OutputDir      string
+	OutputFilename string
+	OutputTemplate string
+
+	// Combine muxes the video and the audio into a single mp4.
+	Combine   bool
+	Overwrite OverwritePolicy
+
+	// Resume continues from the state file of an interrupted download.
+	Resume bool
+
+	// Archive (if any) skips clips which are in it, and records downloaded
+	// clips.
+	Archive *Archive
+
+	// Concurrency and Retry override those of the client when set.
+	Concurrency int
+	Retry       *RetryPolicy
+}
+
+// DownloadResult describes the outcome of a download.
+type DownloadResult struct {
+	ClipId  string
+	VideoId string
+	AudioId string
+
+	// Files are the outputs, i.e. the combined mp4, or the video and audio.
+	// They are set even when the download is skipped for existing files.
+	Files []string
+
+	// Skipped is set when nothing is downloaded since the clip is in the
+	// archive or its outputs exist.
+	Skipped bool
+	Resumed bool
+}
+
+// Downloader downloads a clip with the Client: it chooses the formats,
+// downloads them to part files which are renamed when complete, and
+// combines them if requested. A nil Client is the one of NewClient.
+type Downloader struct {
+	Client  *Client
+	Options DownloadOptions
+}
+
+func NewDownloader(options DownloadOptions) *Downloader {
+	return &Downloader{Client: NewClient(), Options: options}
+}
+
+// Download fetches master.json from masterJsonUrl and downloads the clip.
+func (d *Downloader) Download(ctx context.Context, masterJsonUrl *url.URL) (*DownloadResult, error) {
+	masterJson, err := d.client().GetMasterJsonContext(ctx, masterJsonUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.DownloadMasterJson(ctx, masterJson, masterJsonUrl)
+}
+
+// DownloadMasterJson downloads the clip of a master.json which is already
+// loaded, e.g. from a file. masterJsonUrl is the url which its relative urls
+// are resolved against. masterJson is trimmed in place to the time range.
+func (d *Downloader) DownloadMasterJson(ctx context.Context, masterJson *MasterJson, masterJsonUrl *url.URL) (*DownloadResult, error) {
+	options := d.Options
+	client := d.client()
+	result := &DownloadResult{ClipId: masterJson.ClipId, VideoId: options.VideoId, AudioId: options.AudioId}
+
+	if len(options.Format) > 0 && len(result.VideoId) == 0 && len(result.AudioId) == 0 {
+		selector, err := ParseSelector(options.Format)
+		if err != nil {
+			return nil, err
+		}
+
+		video, audio, err := selector.Select(masterJson)
+		if err != nil {
+			return nil, err
+		}
+
+		if video != nil {
+			result.VideoId = video.Id
+		}
+		if audio != nil {
+			result.AudioId = audio.Id
+		}
+	}
+
+	if options.Archive != nil && options.Archive.Contains(masterJson.ClipId, result.VideoId, result.AudioId) {
+		d.info("Skipping " + masterJson.ClipId + ": already in " + options.Archive.filename)
+		result.Skipped = true
+		return result, nil
+	}
+
+	// the formats are chosen before trimming, since only they are trimmed
+	hasAudio := len(masterJson.Audio) > 0
+	if len(result.VideoId) == 0 {
+		result.VideoId = masterJson.FindMaximumBitrateVideo().Id
+	}
+	if hasAudio && len(result.AudioId) == 0 {
+		result.AudioId = masterJson.FindMaximumBitrateAudio().Id
+	}
+
+	timestampOffset := 0.0
+	if options.Start > 0 || options.End > 0 || options.RebaseTimestamps {
+		tracks, err := downloadTracks(masterJson, result, hasAudio)
+		if err != nil {
+			return nil, err
+		}
+
+		origin, err := TrimTracks(tracks, options.Start, options.End)
+		if err != nil {
+			return nil, err
+		}
+
+		if options.RebaseTimestamps {
+			timestampOffset = origin
+		}
+	}
+
+	filename, err := d.outputFilename(masterJson, result)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := lockOutput(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	err = os.MkdirAll(filepath.Dir(filename), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	videoFilename := filename + "-video.mp4"
+	audioFilename := filename + "-audio.mp4"
+	combinedFilename := filename + ".mp4"
+	result.Files = []string{videoFilename}
+	if hasAudio && options.Combine {
+		result.Files = []string{combinedFilename}
+	} else if hasAudio {
+		result.Files = append(result.Files, audioFilename)
+	}
+
+	skip, err := checkOutputs(options.Overwrite, result.Files)
+	if err != nil {
+		return nil, err
+	}
+	if skip {
+		d.info("Skipping " + masterJson.ClipId + ": " + result.Files[0] + " already exists")
+		result.Skipped = true
+		return result, nil
+	}
+
+	stateFilename := filename + ".state.json"
+	state, err := d.loadResumeState(stateFilename, masterJson, masterJsonUrl, timestampOffset, result)
+	if err != nil {
+		return nil, err
+	}
+	save := func(*TrackState) error {
+		return state.Save(stateFilename)
+	}
+
+	state.VideoId = result.VideoId
+	err = d.writeTrack(partFilename(videoFilename), &state.Video, result.Resumed, func(output io.Writer) error {
+		video, err := masterJson.FindTrack(VideoTrack, state.VideoId)
+		if err != nil {
+			return err
+		}
+
+		return masterJson.ResumeTrackFileContext(ctx, output, masterJsonUrl, video, client, timestampOffset, &state.Video, save)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if hasAudio {
+		state.AudioId = result.AudioId
+		err = d.writeTrack(partFilename(audioFilename), &state.Audio, result.Resumed, func(output io.Writer) error {
+			audio, err := masterJson.FindTrack(AudioTrack, state.AudioId)
+			if err != nil {
+				return err
+			}
+
+			return masterJson.ResumeTrackFileContext(ctx, output, masterJsonUrl, audio, client, timestampOffset, &state.Audio, save)
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		result.AudioId = ""
+	}
+
+	if hasAudio && options.Combine {
+		d.info("Combining to " + combinedFilename)
+		err = muxFiles(combinedFilename, partFilename(videoFilename), partFilename(audioFilename))
+		if err == nil {
+			err = os.Remove(partFilename(videoFilename))
+		}
+		if err == nil {
+			err = os.Remove(partFilename(audioFilename))
+		}
+	} else {
+		err = commitOutput(partFilename(videoFilename), videoFilename)
+		if err == nil && hasAudio {
+			err = commitOutput(partFilename(audioFilename), audioFilename)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the state is kept until the outputs are in place, so that a failed
+	// combine can be resumed
+	err = os.Remove(stateFilename)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	if options.Archive != nil {
+		err = options.Archive.Add(ArchiveEntry{ClipId: masterJson.ClipId, VideoId: result.VideoId, AudioId: result.AudioId})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// downloadTracks returns the video and the audio (if any) of the result.
+func downloadTracks(masterJson *MasterJson, result *DownloadResult, hasAudio bool) ([]Track, error) {
+	video, err := masterJson.FindTrack(VideoTrack, result.VideoId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !hasAudio {
+		return []Track{video}, nil
+	}
+
+	audio, err := masterJson.FindTrack(AudioTrack, result.AudioId)
+	if err != nil {
+		return nil, err
+	}
+
+	return []Track{video, audio}, nil
+}
+
+// client returns a copy of the client with the options applied, so that a
+// client can be shared by downloaders.
+func (d *Downloader) client() *Client {
+	base := d.Client
+	if base == nil {
+		base = NewClient()
+	}
+
+	client := *base
+	if d.Options.Concurrency > 0 {
+		client.Concurrency = d.Options.Concurrency
+	}
+	if d.Options.Retry != nil {
+		client.Retry = *d.Options.Retry
+	}
+
+	return &client
+}
+
+func (d *Downloader) info(message string) {
+	if d.Client != nil && d.Client.Hooks.Info != nil {
+		d.Client.Hooks.Info(message)
+	}
+}
+
+// outputFilename returns the path of the outputs without an extension. The
+// template is rendered for the video and audio which will be downloaded,
+// unless OutputFilename is given by the user, which is not confined.
+func (d *Downloader) outputFilename(masterJson *MasterJson, result *DownloadResult) (string, error) {
+	filename := d.Options.OutputFilename
+	if len(filename) > 0 {
+		if filepath.IsAbs(filename) || len(d.Options.OutputDir) == 0 {
+			return filepath.Clean(filename), nil
+		}
+
+		return filepath.Join(d.Options.OutputDir, filename), nil
+	}
+
+	template := d.Options.OutputTemplate
+	if len(template) == 0 {
+		template = "%(clip_id)s"
+	}
+
+	var video *Video
+	var err error
+	if len(result.VideoId) > 0 {
+		video, err = masterJson.FindVideo(result.VideoId)
+		if err != nil {
+			return "", err
+		}
+	} else if len(masterJson.Video) > 0 {
+		video = masterJson.FindMaximumBitrateVideo()
+	}
+
+	var audio *Audio
+	if len(result.AudioId) > 0 {
+		audio, err = masterJson.FindAudio(result.AudioId)
+		if err != nil {
+			return "", err
+		}
+	} else if len(masterJson.Audio) > 0 {
+		audio = masterJson.FindMaximumBitrateAudio()
+	}
+
+	filename, err = RenderTemplate(template, TemplateFields(masterJson, video, audio))
+	if err != nil {
+		return "", err
+	}
+	filename = strings.TrimSuffix(filename, ".mp4")
+
+	return OutputPath(d.Options.OutputDir, filename)
+}
+
+// loadResumeState returns the state saved by an interrupted download when
+// Resume is set, or a fresh state otherwise. A loaded state must match the
+// clip, the formats and the time range.
+func (d *Downloader) loadResumeState(filename string, masterJson *MasterJson, masterJsonUrl *url.URL, timestampOffset float64, result *DownloadResult) (*ResumeState, error) {
+	if d.Options.Resume {
+		state, err := LoadResumeState(filename)
+		if err == nil {
+			if state.ClipId != masterJson.ClipId {
+				return nil, fmt.Errorf("%s is for clip '%s', not '%s'", filename, state.ClipId, masterJson.ClipId)
+			}
+
+			if len(result.VideoId) > 0 && result.VideoId != state.VideoId {
+				return nil, fmt.Errorf("%s was started with video id '%s'", filename, state.VideoId)
+			}
+
+			if len(result.AudioId) > 0 && len(state.AudioId) > 0 && result.AudioId != state.AudioId {
+				return nil, fmt.Errorf("%s was started with audio id '%s'", filename, state.AudioId)
+			}
+
+			if d.Options.Start != state.Start || d.Options.End != state.End || timestampOffset != state.TimestampOffset {
+				return nil, fmt.Errorf("%s was started with another time range", filename)
+			}
+
+			d.info("Resuming from " + filename)
+			result.VideoId = state.VideoId
+			if len(state.AudioId) > 0 {
+				result.AudioId = state.AudioId
+			}
+			result.Resumed = true
+			state.MasterJsonUrl = masterJsonUrl.String()
+			return state, nil
+		}
+
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	state := &ResumeState{
+		MasterJsonUrl:   masterJsonUrl.String(),
+		ClipId:          masterJson.ClipId,
+		Start:           d.Options.Start,
+		End:             d.Options.End,
+		TimestampOffset: timestampOffset,
+	}
+
+	return state, nil
+}
+
+// writeTrack writes a track to a part file with write, and flushes it.
+func (d *Downloader) writeTrack(filename string, progress *TrackState, resumed bool, write func(output io.Writer) error) error {
+	file, err := openOutput(filename, progress, resumed)
+	if err != nil {
+		return err
+	}
+	d.info("Downloading to " + filename)
+
+	err = write(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return closeOutput(file)
+}
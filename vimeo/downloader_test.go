@@ -0,0 +1,415 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vimeo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func downloaderTestMasterJson() *MasterJson {
+	return &MasterJson{
+		ClipId:  "clip1",
+		BaseUrl: "../",
+		Video: []Video{
+			Video{
+				Id:          "720p",
+				BaseUrl:     "720p/",
+				Height:      720,
+				Bitrate:     2000000,
+				InitSegment: "aW5pdA==",
+				Segments:    []Segment{Segment{Url: "v1.m4s"}, Segment{Url: "v2.m4s"}},
+			},
+			Video{
+				Id:          "360p",
+				BaseUrl:     "360p/",
+				Height:      360,
+				Bitrate:     500000,
+				InitSegment: "aW5pdA==",
+				Segments:    []Segment{Segment{Url: "v1.m4s"}, Segment{Url: "v2.m4s"}},
+			},
+		},
+		Audio: []Audio{
+			Audio{
+				Id:          "a1",
+				BaseUrl:     "a1/",
+				Bitrate:     128000,
+				InitSegment: "aW5pdA==",
+				Segments:    []Segment{Segment{Url: "a1.m4s"}, Segment{Url: "a2.m4s"}},
+			},
+		},
+	}
+}
+
+func newDownloaderTestClient() *Client {
+	client := NewClient()
+	client.Client = NewMockClient(func(req *http.Request) *http.Response {
+		// e.g. "[720p/v1]"
+		return NewMockReponseFromString("[" + strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/"), ".m4s") + "]")
+	})
+
+	return client
+}
+
+func TestDownloaderDownloadMasterJson(t *testing.T) {
+	dir := t.TempDir()
+	masterJsonUrl, _ := url.Parse("https://example.com/video/master.json")
+	downloader := &Downloader{
+		Client:  newDownloaderTestClient(),
+		Options: DownloadOptions{OutputDir: dir, Format: "bestvideo[height<=480]+bestaudio"},
+	}
+
+	result, err := downloader.DownloadMasterJson(context.Background(), downloaderTestMasterJson(), masterJsonUrl)
+	if err != nil {
+		t.Errorf("DownloadMasterJson failed: %v", err)
+		return
+	}
+
+	expected := &DownloadResult{
+		ClipId:  "clip1",
+		VideoId: "360p",
+		AudioId: "a1",
+		Files:   []string{filepath.Join(dir, "clip1-video.mp4"), filepath.Join(dir, "clip1-audio.mp4")},
+	}
+	if !reflect.DeepEqual(expected, result) {
+		t.Errorf("DownloadMasterJson result does not match.\nexpected: %+v\nactual:   %+v", expected, result)
+		return
+	}
+
+	video, _ := os.ReadFile(filepath.Join(dir, "clip1-video.mp4"))
+	if string(video) != "init[360p/v1][360p/v2]" {
+		t.Errorf("video does not match: %s", video)
+		return
+	}
+
+	audio, _ := os.ReadFile(filepath.Join(dir, "clip1-audio.mp4"))
+	if string(audio) != "init[a1/a1][a1/a2]" {
+		t.Errorf("audio does not match: %s", audio)
+		return
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("DownloadMasterJson must leave only the outputs: %v", entries)
+		return
+	}
+}
+
+func TestDownloaderDownloadUsesRetryOption(t *testing.T) {
+	dir := t.TempDir()
+	data, _ := json.Marshal(downloaderTestMasterJson())
+	failures := 0
+	client := NewClient()
+	client.Retry = RetryPolicy{MaxAttempts: 1}
+	client.Client = NewMockClient(func(req *http.Request) *http.Response {
+		if strings.HasSuffix(req.URL.Path, "master.json") {
+			if failures == 0 {
+				failures++
+				return NewMockReponseWithStatus(http.StatusServiceUnavailable, "")
+			}
+
+			return NewMockReponseFromString(string(data))
+		}
+
+		return NewMockReponseFromString("[" + strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/"), ".m4s") + "]")
+	})
+
+	masterJsonUrl, _ := url.Parse("https://example.com/video/master.json")
+	downloader := &Downloader{
+		Client: client,
+		Options: DownloadOptions{
+			OutputDir: dir,
+			Retry:     &RetryPolicy{MaxAttempts: 2, RetryableStatusCodes: []int{http.StatusServiceUnavailable}},
+		},
+	}
+
+	result, err := downloader.Download(context.Background(), masterJsonUrl)
+	if err != nil {
+		t.Errorf("Download must retry master.json with the Retry option: %v", err)
+		return
+	}
+
+	expected := []string{filepath.Join(dir, "clip1-video.mp4"), filepath.Join(dir, "clip1-audio.mp4")}
+	if !reflect.DeepEqual(expected, result.Files) {
+		t.Errorf("Download files do not match.\nexpected: %v\nactual:   %v", expected, result.Files)
+		return
+	}
+}
+
+func TestDownloaderTrimsOnlyChosenTracks(t *testing.T) {
+	dir := t.TempDir()
+	masterJson := downloaderTestMasterJson()
+	for i := range masterJson.Video {
+		masterJson.Video[i].Segments = []Segment{Segment{Url: "v1.m4s", Start: 0, End: 6}, Segment{Url: "v2.m4s", Start: 6, End: 12}}
+	}
+	masterJson.Audio[0].Segments = []Segment{Segment{Url: "a1.m4s", Start: 0, End: 6}, Segment{Url: "a2.m4s", Start: 6, End: 12}}
+	// a shorter audio which is not chosen
+	masterJson.Audio = append(masterJson.Audio, Audio{
+		Id:          "a2",
+		BaseUrl:     "a2/",
+		Bitrate:     64000,
+		InitSegment: "aW5pdA==",
+		Segments:    []Segment{Segment{Url: "a1.m4s", Start: 0, End: 5.9}},
+	})
+
+	masterJsonUrl, _ := url.Parse("https://example.com/video/master.json")
+	downloader := &Downloader{
+		Client:  newDownloaderTestClient(),
+		Options: DownloadOptions{OutputDir: dir, Start: 8},
+	}
+
+	result, err := downloader.DownloadMasterJson(context.Background(), masterJson, masterJsonUrl)
+	if err != nil {
+		t.Errorf("DownloadMasterJson must not trim other tracks: %v", err)
+		return
+	}
+
+	if result.VideoId != "720p" || result.AudioId != "a1" {
+		t.Errorf("DownloadMasterJson formats do not match: %+v", result)
+		return
+	}
+
+	if len(masterJson.Video[0].Segments) != 1 || len(masterJson.Audio[1].Segments) != 1 || len(masterJson.Video[1].Segments) != 2 {
+		t.Errorf("DownloadMasterJson must trim only the chosen tracks: %+v", masterJson)
+		return
+	}
+}
+
+func TestDownloaderSerializesSameOutputs(t *testing.T) {
+	dir := t.TempDir()
+	masterJsonUrl, _ := url.Parse("https://example.com/video/master.json")
+	errs := make(chan error)
+	for i := 0; i < 2; i++ {
+		go func() {
+			downloader := &Downloader{Client: newDownloaderTestClient(), Options: DownloadOptions{OutputDir: dir}}
+			_, err := downloader.DownloadMasterJson(context.Background(), downloaderTestMasterJson(), masterJsonUrl)
+			errs <- err
+		}()
+	}
+
+	failed := 0
+	for i := 0; i < 2; i++ {
+		err := <-errs
+		if errors.Is(err, fs.ErrExist) {
+			failed++
+		} else if err != nil {
+			t.Errorf("DownloadMasterJson failed: %v", err)
+			return
+		}
+	}
+
+	if failed != 1 {
+		t.Errorf("the second download of the same outputs must find them: %d failed", failed)
+		return
+	}
+
+	actual, err := os.ReadFile(filepath.Join(dir, "clip1-video.mp4"))
+	expected := "init[720p/v1][720p/v2]"
+	if err != nil || string(actual) != expected {
+		t.Errorf("video output does not match (%v).\nexpected: %v\nactual:   %v", err, expected, string(actual))
+		return
+	}
+}
+
+func TestDownloaderRendersOutputTemplate(t *testing.T) {
+	dir := t.TempDir()
+	masterJsonUrl, _ := url.Parse("https://example.com/video/master.json")
+	downloader := &Downloader{
+		Client:  newDownloaderTestClient(),
+		Options: DownloadOptions{OutputDir: dir, OutputTemplate: "%(clip_id)s/%(height)sp.%(ext)s"},
+	}
+
+	result, err := downloader.DownloadMasterJson(context.Background(), downloaderTestMasterJson(), masterJsonUrl)
+	if err != nil {
+		t.Errorf("DownloadMasterJson failed: %v", err)
+		return
+	}
+
+	expected := []string{filepath.Join(dir, "clip1", "720p-video.mp4"), filepath.Join(dir, "clip1", "720p-audio.mp4")}
+	if !reflect.DeepEqual(expected, result.Files) {
+		t.Errorf("DownloadMasterJson files do not match.\nexpected: %v\nactual:   %v", expected, result.Files)
+		return
+	}
+}
+
+func TestDownloaderRejectsOutputsOutsideOutputDir(t *testing.T) {
+	dir := t.TempDir()
+	masterJsonUrl, _ := url.Parse("https://example.com/video/master.json")
+	downloader := &Downloader{
+		Client:  newDownloaderTestClient(),
+		Options: DownloadOptions{OutputDir: dir, OutputTemplate: "../%(clip_id)s"},
+	}
+
+	_, err := downloader.DownloadMasterJson(context.Background(), downloaderTestMasterJson(), masterJsonUrl)
+	if err == nil {
+		t.Errorf("DownloadMasterJson must reject an output outside of the output directory")
+		return
+	}
+}
+
+func TestDownloaderAllowsOutputFilenameOutsideOutputDir(t *testing.T) {
+	dir := t.TempDir()
+	other := t.TempDir()
+	masterJsonUrl, _ := url.Parse("https://example.com/video/master.json")
+	downloader := &Downloader{
+		Client:  newDownloaderTestClient(),
+		Options: DownloadOptions{OutputDir: dir, OutputFilename: filepath.Join(other, "clip1")},
+	}
+
+	result, err := downloader.DownloadMasterJson(context.Background(), downloaderTestMasterJson(), masterJsonUrl)
+	if err != nil {
+		t.Errorf("DownloadMasterJson failed: %v", err)
+		return
+	}
+
+	expected := []string{filepath.Join(other, "clip1-video.mp4"), filepath.Join(other, "clip1-audio.mp4")}
+	if !reflect.DeepEqual(expected, result.Files) {
+		t.Errorf("DownloadMasterJson files do not match.\nexpected: %v\nactual:   %v", expected, result.Files)
+		return
+	}
+}
+
+func TestDownloaderOverwritePolicy(t *testing.T) {
+	dir := t.TempDir()
+	masterJsonUrl, _ := url.Parse("https://example.com/video/master.json")
+	videoFilename := filepath.Join(dir, "clip1-video.mp4")
+	audioFilename := filepath.Join(dir, "clip1-audio.mp4")
+	os.WriteFile(videoFilename, []byte("old"), 0644)
+
+	downloader := &Downloader{
+		Client:  newDownloaderTestClient(),
+		Options: DownloadOptions{OutputDir: dir},
+	}
+	_, err := downloader.DownloadMasterJson(context.Background(), downloaderTestMasterJson(), masterJsonUrl)
+	if !errors.Is(err, fs.ErrExist) {
+		t.Errorf("DownloadMasterJson must fail for an existing output: %v", err)
+		return
+	}
+
+	// every output must exist to be skipped
+	downloader.Options.Overwrite = SkipExisting
+	_, err = downloader.DownloadMasterJson(context.Background(), downloaderTestMasterJson(), masterJsonUrl)
+	if !errors.Is(err, fs.ErrExist) {
+		t.Errorf("DownloadMasterJson must fail for a partially existing output: %v", err)
+		return
+	}
+
+	os.WriteFile(audioFilename, []byte("old"), 0644)
+	result, err := downloader.DownloadMasterJson(context.Background(), downloaderTestMasterJson(), masterJsonUrl)
+	if err != nil || !result.Skipped {
+		t.Errorf("DownloadMasterJson must skip existing outputs: %+v, %v", result, err)
+		return
+	}
+
+	downloader.Options.Overwrite = Overwrite
+	result, err = downloader.DownloadMasterJson(context.Background(), downloaderTestMasterJson(), masterJsonUrl)
+	if err != nil || result.Skipped {
+		t.Errorf("DownloadMasterJson must overwrite outputs: %+v, %v", result, err)
+		return
+	}
+
+	video, _ := os.ReadFile(videoFilename)
+	if string(video) != "init[720p/v1][720p/v2]" {
+		t.Errorf("video must be overwritten: %s", video)
+		return
+	}
+}
+
+func TestDownloaderUsesArchive(t *testing.T) {
+	dir := t.TempDir()
+	masterJsonUrl, _ := url.Parse("https://example.com/video/master.json")
+	archive, err := OpenArchive(filepath.Join(dir, "archive.txt"))
+	if err != nil {
+		t.Errorf("OpenArchive failed: %v", err)
+		return
+	}
+
+	downloader := &Downloader{
+		Client:  newDownloaderTestClient(),
+		Options: DownloadOptions{OutputDir: dir, Archive: archive},
+	}
+	_, err = downloader.DownloadMasterJson(context.Background(), downloaderTestMasterJson(), masterJsonUrl)
+	if err != nil {
+		t.Errorf("DownloadMasterJson failed: %v", err)
+		return
+	}
+
+	if !archive.Contains("clip1", "720p", "a1") {
+		t.Errorf("DownloadMasterJson must add the clip to the archive")
+		return
+	}
+
+	result, err := downloader.DownloadMasterJson(context.Background(), downloaderTestMasterJson(), masterJsonUrl)
+	if err != nil || !result.Skipped {
+		t.Errorf("DownloadMasterJson must skip an archived clip: %+v, %v", result, err)
+		return
+	}
+}
+
+func TestDownloaderKeepsPartFilesOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	masterJsonUrl, _ := url.Parse("https://example.com/video/master.json")
+	client := NewClient()
+	client.Retry.MaxAttempts = 1
+	client.Client = NewMockClient(func(req *http.Request) *http.Response {
+		if req.URL.Path == "/720p/v2.m4s" {
+			return NewMockReponseWithStatus(http.StatusNotFound, "")
+		}
+		return NewMockReponseFromString("ok")
+	})
+
+	downloader := &Downloader{Client: client, Options: DownloadOptions{OutputDir: dir}}
+	_, err := downloader.DownloadMasterJson(context.Background(), downloaderTestMasterJson(), masterJsonUrl)
+	if err == nil {
+		t.Errorf("DownloadMasterJson must fail")
+		return
+	}
+
+	for _, name := range []string{"clip1-video.mp4.part", "clip1.state.json"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s must be kept to resume: %v", name, err)
+			return
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "clip1-video.mp4")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("an incomplete output must not be renamed into place: %v", err)
+		return
+	}
+
+	// resume with a working server
+	downloader.Client = newDownloaderTestClient()
+	downloader.Options.Resume = true
+	result, err := downloader.DownloadMasterJson(context.Background(), downloaderTestMasterJson(), masterJsonUrl)
+	if err != nil || !result.Resumed {
+		t.Errorf("DownloadMasterJson must resume: %+v, %v", result, err)
+		return
+	}
+
+	video, _ := os.ReadFile(filepath.Join(dir, "clip1-video.mp4"))
+	if string(video) != "initok[720p/v2]" {
+		t.Errorf("resumed video does not match: %s", video)
+		return
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vimeo
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const maxErrorBodySize = 512
+
+// HTTPError is returned when a request completes with a non-2xx status.
+type HTTPError struct {
+	StatusCode int
+	Url        string
+	Header     http.Header
+	Body       string
+}
+
+func newHTTPError(url string, res *http.Response) *HTTPError {
+	body, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBodySize))
+
+	return &HTTPError{
+		StatusCode: res.StatusCode,
+		Url:        url,
+		Header:     res.Header,
+		Body:       string(body),
+	}
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Url)
+}
+
+// ProtocolError is returned when a server responds in a way which another
+// attempt would not change, e.g. by ignoring the Range header. It is never
+// retried.
+type ProtocolError struct {
+	Url     string
+	Message string
+}
+
+func (e *ProtocolError) Error() string {
+	return e.Url + ": " + e.Message
+}
+
+// SegmentError describes which segment of a video or audio failed.
+type SegmentError struct {
+	Index int
+	Url   string
+	Err   error
+}
+
+func (e *SegmentError) Error() string {
+	return fmt.Sprintf("segment %d failed: %v", e.Index+1, e.Err)
+}
+
+func (e *SegmentError) Unwrap() error {
+	return e.Err
+}
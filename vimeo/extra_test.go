@@ -0,0 +1,47 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vimeo
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSegmentMarshalJSONKeepsExtra(t *testing.T) {
+	input := `{"end":6,"range":"0-999","size":10,"unknown":"x","url":"segment-1.m4s"}`
+
+	var segment Segment
+	err := json.Unmarshal([]byte(input), &segment)
+	if err != nil {
+		t.Errorf("Unmarshal failed: %v", err)
+		return
+	}
+
+	if string(segment.Extra["unknown"]) != `"x"` {
+		t.Errorf("Unmarshal must keep unknown fields: %v", segment.Extra)
+		return
+	}
+
+	actual, err := json.Marshal(segment)
+	if err != nil {
+		t.Errorf("Marshal failed: %v", err)
+		return
+	}
+
+	if string(actual) != input {
+		t.Errorf("Marshal output does not match.\nexpected: %v\nactual:   %v", input, string(actual))
+		return
+	}
+}
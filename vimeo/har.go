@@ -0,0 +1,168 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vimeo
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+)
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harEntry struct {
+	Request struct {
+		Method  string         `json:"method"`
+		Url     string         `json:"url"`
+		Headers []harNameValue `json:"headers"`
+	} `json:"request"`
+	Response struct {
+		Status  int `json:"status"`
+		Content struct {
+			Text     string `json:"text"`
+			Encoding string `json:"encoding"`
+		} `json:"content"`
+	} `json:"response"`
+}
+
+type har struct {
+	Log struct {
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+// harHeaders are the request headers which are reused for the requests of
+// segments, since signed urls may be checked against them.
+var harHeaders = []string{"Cookie", "Origin", "Referer", "User-Agent"}
+
+// HarRequest is a request of master.json (or playlist.json) recorded in a
+// HAR file of the browser.
+type HarRequest struct {
+	Url    *url.URL
+	Header http.Header
+	// Body is the recorded response, or nil if it was not recorded.
+	Body []byte
+}
+
+// FindMasterJsonsInHar returns a request of master.json or playlist.json
+// for each clip in a HAR file, in the order they were first requested.
+// playlist.json is used only if there is no master.json at all. When a clip
+// is requested more than once, the last request is used, since its url is
+// signed most recently.
+func FindMasterJsonsInHar(data []byte) ([]*HarRequest, error) {
+	h := new(har)
+	err := json.Unmarshal(data, h)
+	if err != nil {
+		return nil, err
+	}
+
+	var masterJsons, playlistJsons []*harEntry
+	for i := range h.Log.Entries {
+		entry := &h.Log.Entries[i]
+		if entry.Request.Method != "" && entry.Request.Method != http.MethodGet {
+			continue
+		}
+
+		u, err := url.Parse(entry.Request.Url)
+		if err != nil {
+			continue
+		}
+
+		switch path.Base(u.Path) {
+		case "master.json":
+			masterJsons = append(masterJsons, entry)
+		case "playlist.json":
+			playlistJsons = append(playlistJsons, entry)
+		}
+	}
+
+	entries := masterJsons
+	if len(entries) == 0 {
+		entries = playlistJsons
+	}
+
+	if len(entries) == 0 {
+		return nil, errors.New("no master.json or playlist.json is found in the HAR file")
+	}
+
+	requests := []*HarRequest{}
+	clips := map[string]int{}
+	for _, entry := range entries {
+		request, err := newHarRequest(entry)
+		if err != nil {
+			return nil, err
+		}
+
+		clip := harClip(request)
+		if i, ok := clips[clip]; ok {
+			requests[i] = request
+			continue
+		}
+
+		clips[clip] = len(requests)
+		requests = append(requests, request)
+	}
+
+	return requests, nil
+}
+
+// harClip identifies the clip of a request by the clip id of its recorded
+// response, or else by the path of its url.
+func harClip(request *HarRequest) string {
+	if request.Body != nil {
+		masterJson, err := ParseMasterJson(request.Body)
+		if err == nil && len(masterJson.ClipId) > 0 {
+			return masterJson.ClipId
+		}
+	}
+
+	return request.Url.Path
+}
+
+func newHarRequest(entry *harEntry) (*HarRequest, error) {
+	u, err := url.Parse(entry.Request.Url)
+	if err != nil {
+		return nil, err
+	}
+
+	request := &HarRequest{Url: u, Header: http.Header{}}
+	for _, h := range entry.Request.Headers {
+		for _, name := range harHeaders {
+			if http.CanonicalHeaderKey(h.Name) == name {
+				request.Header.Add(name, h.Value)
+			}
+		}
+	}
+
+	content := entry.Response.Content
+	if entry.Response.Status == http.StatusOK && len(content.Text) > 0 {
+		if content.Encoding == "base64" {
+			request.Body, err = base64.StdEncoding.DecodeString(content.Text)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			request.Body = []byte(content.Text)
+		}
+	}
+
+	return request, nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vimeo
+
+import (
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestFindMasterJsonsInHar(t *testing.T) {
+	data, err := os.ReadFile("testdata/master_json.har")
+	if err != nil {
+		t.Errorf("failed to read fixture: %v", err)
+		return
+	}
+
+	requests, err := FindMasterJsonsInHar(data)
+	if err != nil {
+		t.Errorf("FindMasterJsonsInHar failed: %v", err)
+		return
+	}
+
+	if len(requests) != 1 {
+		t.Errorf("FindMasterJsonsInHar must find a request: %v", requests)
+		return
+	}
+	request := requests[0]
+
+	expectedUrl := "https://vod-adaptive-ak.vimeocdn.com/exp=1700000000~hmac=abc/123/sep/video/720p/master.json?base64_init=1"
+	if request.Url.String() != expectedUrl {
+		t.Errorf("FindMasterJsonsInHar url does not match.\nexpected: %v\nactual:   %v", expectedUrl, request.Url)
+	}
+
+	expectedHeader := http.Header{
+		"Cookie":     []string{"vuid=123"},
+		"Origin":     []string{"https://player.vimeo.com"},
+		"Referer":    []string{"https://player.vimeo.com/"},
+		"User-Agent": []string{"Mozilla/5.0 (X11; Linux x86_64) Chrome/120.0"},
+	}
+	if !reflect.DeepEqual(expectedHeader, request.Header) {
+		t.Errorf("FindMasterJsonsInHar header does not match.\nexpected: %v\nactual:   %v", expectedHeader, request.Header)
+	}
+
+	masterJson, err := ParseMasterJson(request.Body)
+	if err != nil {
+		t.Errorf("FindMasterJsonsInHar body is not master.json: %v", err)
+		return
+	}
+
+	if masterJson.ClipId != "clip1" {
+		t.Errorf("FindMasterJsonsInHar body does not match: %v", masterJson)
+	}
+}
+
+func TestFindMasterJsonsInHarWithPlaylistJson(t *testing.T) {
+	data := []byte(`{"log":{"entries":[
+		{"request":{"method":"GET","url":"https://example.com/v2/playlist/av/primary/playlist.json","headers":[]},"response":{"status":403,"content":{"text":"Forbidden"}}}
+	]}}`)
+
+	requests, err := FindMasterJsonsInHar(data)
+	if err != nil {
+		t.Errorf("FindMasterJsonsInHar failed: %v", err)
+		return
+	}
+
+	if len(requests) != 1 {
+		t.Errorf("FindMasterJsonsInHar must find a request: %v", requests)
+		return
+	}
+	request := requests[0]
+
+	if request.Url.String() != "https://example.com/v2/playlist/av/primary/playlist.json" {
+		t.Errorf("FindMasterJsonsInHar url does not match: %v", request.Url)
+	}
+
+	if request.Body != nil {
+		t.Errorf("FindMasterJsonsInHar must ignore failed responses: %s", request.Body)
+	}
+}
+
+func TestFindMasterJsonsInHarWithoutMasterJson(t *testing.T) {
+	_, err := FindMasterJsonsInHar([]byte(`{"log":{"entries":[{"request":{"method":"GET","url":"https://example.com/"}}]}}`))
+	if err == nil {
+		t.Errorf("FindMasterJsonsInHar must fail without master.json")
+	}
+}
+
+func TestFindMasterJsonsInHarWithClips(t *testing.T) {
+	data := []byte(`{"log":{"entries":[
+		{"request":{"method":"GET","url":"https://example.com/exp=1~hmac=a/1/sep/video/master.json","headers":[]},"response":{"status":200,"content":{"text":"{\"clip_id\":\"clip1\"}"}}},
+		{"request":{"method":"GET","url":"https://example.com/exp=1~hmac=b/2/sep/video/master.json","headers":[]},"response":{"status":200,"content":{"text":"{\"clip_id\":\"clip2\"}"}}},
+		{"request":{"method":"GET","url":"https://example.com/exp=2~hmac=c/1/sep/video/master.json","headers":[]},"response":{"status":200,"content":{"text":"{\"clip_id\":\"clip1\"}"}}},
+		{"request":{"method":"GET","url":"https://example.com/3/v2/playlist/av/primary/playlist.json","headers":[]},"response":{"status":403}}
+	]}}`)
+
+	requests, err := FindMasterJsonsInHar(data)
+	if err != nil {
+		t.Errorf("FindMasterJsonsInHar failed: %v", err)
+		return
+	}
+
+	expected := []string{
+		"https://example.com/exp=2~hmac=c/1/sep/video/master.json",
+		"https://example.com/exp=1~hmac=b/2/sep/video/master.json",
+	}
+	actual := []string{}
+	for _, request := range requests {
+		actual = append(actual, request.Url.String())
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("FindMasterJsonsInHar urls do not match.\nexpected: %v\nactual:   %v", expected, actual)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vimeo
+
+import (
+	"io"
+	"time"
+)
+
+// TrackEvent identifies a video or audio which is being downloaded.
+type TrackEvent struct {
+	Type          string // "video" or "audio"
+	Id            string
+	Segments      int
+	EstimatedSize int64
+}
+
+// SegmentEvent identifies a segment of a track. Index starts at 0.
+type SegmentEvent struct {
+	TrackEvent
+	Index int
+	Url   string
+}
+
+// RetryEvent describes a failed request which is about to be retried.
+type RetryEvent struct {
+	Description string
+	Attempt     int // the attempt which will be made after Delay
+	MaxAttempts int
+	Delay       time.Duration
+	Err         error
+}
+
+// Hooks receive the progress of downloads. Every hook is optional.
+//
+// SegmentStarted, BytesReceived and Retry are called from the download
+// workers, possibly at the same time, while the others are called from the
+// goroutine which started the download.
+type Hooks struct {
+	// TrackStarted is called before a track is downloaded, with the part
+	// which is already downloaded when it is resumed.
+	TrackStarted func(e TrackEvent, state TrackState)
+
+	// SegmentStarted is called before the first attempt of a segment.
+	SegmentStarted func(e SegmentEvent)
+
+	// BytesReceived is called as the body of a segment is read. Bytes of a
+	// failed attempt are reported as well.
+	BytesReceived func(e SegmentEvent, n int)
+
+	// SegmentFinished is called after a segment is written to the output,
+	// in order. size is the number of bytes written.
+	SegmentFinished func(e SegmentEvent, size int64)
+
+	Retry func(e RetryEvent)
+
+	// Error is called when the download of a track fails.
+	Error func(e TrackEvent, err error)
+
+	// Completed is called when every segment of a track is written.
+	Completed func(e TrackEvent)
+
+	// Info receives messages about the steps of a Downloader, e.g. the
+	// files which are written.
+	Info func(message string)
+}
+
+// observeTrack runs the download of a track and reports its progress.
+func (c *Client) observeTrack(track TrackEvent, state *TrackState, download func() error) error {
+	if c.Hooks.TrackStarted != nil {
+		c.Hooks.TrackStarted(track, *state)
+	}
+
+	err := download()
+	if err != nil {
+		if c.Hooks.Error != nil {
+			c.Hooks.Error(track, err)
+		}
+		return err
+	}
+
+	if c.Hooks.Completed != nil {
+		c.Hooks.Completed(track)
+	}
+
+	return nil
+}
+
+// receiveWriter reports the bytes written through it to BytesReceived.
+type receiveWriter struct {
+	w     io.Writer
+	event SegmentEvent
+	hook  func(e SegmentEvent, n int)
+}
+
+func (r *receiveWriter) Write(p []byte) (int, error) {
+	n, err := r.w.Write(p)
+	if n > 0 {
+		r.hook(r.event, n)
+	}
+
+	return n, err
+}
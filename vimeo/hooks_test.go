@@ -0,0 +1,157 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vimeo
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func hooksTestMasterJson() MasterJson {
+	return MasterJson{
+		BaseUrl: "../",
+		Video: []Video{
+			Video{
+				Id:          "720p",
+				BaseUrl:     "720p/",
+				InitSegment: "aW5pdA==",
+				Segments: []Segment{
+					Segment{Url: "segment-1.m4s"},
+					Segment{Url: "segment-2.m4s"},
+					Segment{Url: "segment-3.m4s"},
+				},
+			},
+		},
+	}
+}
+
+func TestHooksReportSegments(t *testing.T) {
+	masterJson := hooksTestMasterJson()
+	masterJsonUrl, _ := url.Parse("https://example.com/video/master.json")
+
+	var mu sync.Mutex
+	started := map[int]bool{}
+	received := 0
+	finished := []string{}
+	completed := []TrackEvent{}
+
+	client := NewClient()
+	client.Concurrency = 2
+	client.Client = NewMockClient(func(req *http.Request) *http.Response {
+		return NewMockReponseFromString("segment")
+	})
+	client.Hooks = Hooks{
+		SegmentStarted: func(e SegmentEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			started[e.Index] = true
+		},
+		BytesReceived: func(e SegmentEvent, n int) {
+			mu.Lock()
+			defer mu.Unlock()
+			received += n
+		},
+		SegmentFinished: func(e SegmentEvent, size int64) {
+			finished = append(finished, fmt.Sprintf("%d:%d:%s", e.Index, size, e.Url))
+		},
+		Error: func(e TrackEvent, err error) {
+			t.Errorf("Error hook must not be called: %v", err)
+		},
+		Completed: func(e TrackEvent) {
+			completed = append(completed, e)
+		},
+	}
+
+	err := masterJson.CreateVideoFile(new(bytes.Buffer), masterJsonUrl, "720p", client)
+	if err != nil {
+		t.Errorf("CreateVideoFile failed: %v", err)
+		return
+	}
+
+	if len(started) != 3 || received != 21 {
+		t.Errorf("hooks must report 3 segments and 21 bytes: %v, %d", started, received)
+		return
+	}
+
+	expectedFinished := []string{
+		"0:7:https://example.com/720p/segment-1.m4s",
+		"1:7:https://example.com/720p/segment-2.m4s",
+		"2:7:https://example.com/720p/segment-3.m4s",
+	}
+	if !reflect.DeepEqual(expectedFinished, finished) {
+		t.Errorf("SegmentFinished events do not match.\nexpected: %v\nactual:   %v", expectedFinished, finished)
+		return
+	}
+
+	expectedCompleted := []TrackEvent{TrackEvent{Type: "video", Id: "720p", Segments: 3}}
+	if !reflect.DeepEqual(expectedCompleted, completed) {
+		t.Errorf("Completed events do not match.\nexpected: %v\nactual:   %v", expectedCompleted, completed)
+		return
+	}
+}
+
+func TestHooksReportRetryAndError(t *testing.T) {
+	masterJson := hooksTestMasterJson()
+	masterJsonUrl, _ := url.Parse("https://example.com/video/master.json")
+
+	var mu sync.Mutex
+	retries := []RetryEvent{}
+	var failed *TrackEvent
+
+	client := NewClient()
+	client.Retry.MaxAttempts = 2
+	client.Retry.BaseDelay = time.Millisecond
+	client.Client = NewMockClient(func(req *http.Request) *http.Response {
+		if req.URL.Path == "/720p/segment-2.m4s" {
+			return NewMockReponseWithStatus(http.StatusServiceUnavailable, "")
+		}
+		return NewMockReponseFromString("segment")
+	})
+	client.Hooks = Hooks{
+		Retry: func(e RetryEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			retries = append(retries, e)
+		},
+		Error: func(e TrackEvent, err error) {
+			failed = &e
+		},
+		Completed: func(e TrackEvent) {
+			t.Errorf("Completed hook must not be called")
+		},
+	}
+
+	err := masterJson.CreateVideoFile(new(bytes.Buffer), masterJsonUrl, "720p", client)
+	if err == nil {
+		t.Errorf("CreateVideoFile must fail")
+		return
+	}
+
+	if len(retries) != 1 || retries[0].Description != "segment 2" || retries[0].Attempt != 2 || retries[0].MaxAttempts != 2 {
+		t.Errorf("Retry must be reported once for segment 2: %+v", retries)
+		return
+	}
+
+	if failed == nil || failed.Id != "720p" {
+		t.Errorf("Error must be reported for the video: %+v", failed)
+		return
+	}
+}
@@ -15,31 +15,67 @@
 package vimeo
 
 import (
+	"context"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/url"
+	"strings"
+
+	"github.com/akiomik/vimeo-dl/vimeo/mp4"
 )
 
 type Segment struct {
-	Url string `json:"url"`
+	Url   string  `json:"url"`
+	Range string  `json:"range,omitempty"`
+	Start float64 `json:"start,omitempty"`
+	End   float64 `json:"end,omitempty"`
+	Size  int64   `json:"size,omitempty"`
+	Extra Extra   `json:"-"`
 }
 
 type Video struct {
-	Id          string    `json:"id"`
-	BaseUrl     string    `json:"base_url"`
-	Bitrate     int       `json:"bitrate"`
-	InitSegment string    `json:"init_segment"`
-	Segments    []Segment `json:"segments"`
+	Id                 string    `json:"id"`
+	BaseUrl            string    `json:"base_url"`
+	Format             string    `json:"format,omitempty"`
+	MimeType           string    `json:"mime_type,omitempty"`
+	Codecs             string    `json:"codecs,omitempty"`
+	Bitrate            int       `json:"bitrate"`
+	AvgBitrate         int       `json:"avg_bitrate,omitempty"`
+	Duration           float64   `json:"duration,omitempty"`
+	Framerate          float64   `json:"framerate,omitempty"`
+	Width              int       `json:"width,omitempty"`
+	Height             int       `json:"height,omitempty"`
+	MaxSegmentDuration float64   `json:"max_segment_duration,omitempty"`
+	InitSegment        string    `json:"init_segment"`
+	IndexSegment       string    `json:"index_segment,omitempty"`
+	InitSegmentRange   string    `json:"init_segment_range,omitempty"`
+	IndexSegmentRange  string    `json:"index_segment_range,omitempty"`
+	Segments           []Segment `json:"segments"`
+	Extra              Extra     `json:"-"`
 }
 
 type Audio struct {
-	Id          string    `json:"id"`
-	BaseUrl     string    `json:"base_url"`
-	Bitrate     int       `json:"bitrate"`
-	InitSegment string    `json:"init_segment"`
-	Segments    []Segment `json:"segments"`
+	Id                 string    `json:"id"`
+	BaseUrl            string    `json:"base_url"`
+	Format             string    `json:"format,omitempty"`
+	MimeType           string    `json:"mime_type,omitempty"`
+	Codecs             string    `json:"codecs,omitempty"`
+	Bitrate            int       `json:"bitrate"`
+	AvgBitrate         int       `json:"avg_bitrate,omitempty"`
+	Duration           float64   `json:"duration,omitempty"`
+	Channels           int       `json:"channels,omitempty"`
+	SampleRate         int       `json:"sample_rate,omitempty"`
+	MaxSegmentDuration float64   `json:"max_segment_duration,omitempty"`
+	InitSegment        string    `json:"init_segment"`
+	IndexSegment       string    `json:"index_segment,omitempty"`
+	InitSegmentRange   string    `json:"init_segment_range,omitempty"`
+	IndexSegmentRange  string    `json:"index_segment_range,omitempty"`
+	Segments           []Segment `json:"segments"`
+	Extra              Extra     `json:"-"`
 }
 
 type MasterJson struct {
@@ -47,6 +83,70 @@ type MasterJson struct {
 	BaseUrl string  `json:"base_url"`
 	Video   []Video `json:"video"`
 	Audio   []Audio `json:"audio"`
+	Extra   Extra   `json:"-"`
+}
+
+func ParseMasterJson(data []byte) (*MasterJson, error) {
+	masterJson := new(MasterJson)
+	err := json.Unmarshal(data, masterJson)
+	if err != nil {
+		return nil, err
+	}
+
+	return masterJson, nil
+}
+
+func (s *Segment) UnmarshalJSON(data []byte) error {
+	type segment Segment
+	extra, err := unmarshalWithExtra(data, (*segment)(s))
+	s.Extra = extra
+	return err
+}
+
+func (s Segment) MarshalJSON() ([]byte, error) {
+	type segment Segment
+	return marshalWithExtra(segment(s), s.Extra)
+}
+
+func (v *Video) UnmarshalJSON(data []byte) error {
+	type video Video
+	extra, err := unmarshalWithExtra(data, (*video)(v))
+	v.Extra = extra
+	return err
+}
+
+func (v Video) MarshalJSON() ([]byte, error) {
+	type video Video
+	return marshalWithExtra(video(v), v.Extra)
+}
+
+func (a *Audio) UnmarshalJSON(data []byte) error {
+	type audio Audio
+	extra, err := unmarshalWithExtra(data, (*audio)(a))
+	a.Extra = extra
+	return err
+}
+
+func (a Audio) MarshalJSON() ([]byte, error) {
+	type audio Audio
+	return marshalWithExtra(audio(a), a.Extra)
+}
+
+func (mj *MasterJson) UnmarshalJSON(data []byte) error {
+	type masterJson MasterJson
+	extra, err := unmarshalWithExtra(data, (*masterJson)(mj))
+	mj.Extra = extra
+	return err
+}
+
+func (mj MasterJson) MarshalJSON() ([]byte, error) {
+	type masterJson MasterJson
+	return marshalWithExtra(masterJson(mj), mj.Extra)
+}
+
+// Duration returns the length of the segment in seconds.
+func (s *Segment) Duration() float64 {
+	return s.End - s.Start
 }
 
 func (v *Video) DecodedInitSegment() ([]byte, error) {
@@ -67,170 +167,356 @@ func (a *Audio) DecodedInitSegment() ([]byte, error) {
 	return decoded, err
 }
 
-func (mj *MasterJson) FindVideo(id string) (*Video, error) {
-	video := new(Video)
-	for _, v := range mj.Video {
-		if v.Id == id {
-			video = &v
-			break
-		}
+func (v *Video) InitSegmentInfo() (*mp4.Info, error) {
+	initSegment, err := v.DecodedInitSegment()
+	if err != nil {
+		return nil, err
 	}
 
-	if len(video.Id) == 0 {
-		return nil, errors.New("A video which has id '" + id + "' is not found in MasterJson")
+	return mp4.InspectBytes(initSegment)
+}
+
+func (a *Audio) InitSegmentInfo() (*mp4.Info, error) {
+	initSegment, err := a.DecodedInitSegment()
+	if err != nil {
+		return nil, err
 	}
 
-	return video, nil
+	return mp4.InspectBytes(initSegment)
 }
 
-func (mj *MasterJson) FindAudio(id string) (*Audio, error) {
-	audio := new(Audio)
-	for _, a := range mj.Audio {
-		if a.Id == id {
-			audio = &a
+// EstimatedSize returns the size of the video in bytes. The sum of segment
+// sizes is used if available, or else it is estimated from the bitrate.
+func (v *Video) EstimatedSize() int64 {
+	return estimateSize(v.Segments, v.AvgBitrate, v.Bitrate, v.Duration)
+}
+
+func (a *Audio) EstimatedSize() int64 {
+	return estimateSize(a.Segments, a.AvgBitrate, a.Bitrate, a.Duration)
+}
+
+func estimateSize(segments []Segment, avgBitrate int, bitrate int, duration float64) int64 {
+	var size int64
+	for _, s := range segments {
+		segmentSize := s.Size
+		if segmentSize <= 0 && len(s.Range) > 0 {
+			first, last, err := parseByteRange(s.Range)
+			if err == nil {
+				segmentSize = last - first + 1
+			}
+		}
+
+		if segmentSize <= 0 {
+			size = 0
 			break
 		}
+		size += segmentSize
+	}
+	if size > 0 {
+		return size
+	}
+
+	if duration == 0 {
+		for _, s := range segments {
+			duration += s.Duration()
+		}
 	}
 
-	if len(audio.Id) == 0 {
-		return nil, errors.New("A audio which has id '" + id + "' is not found in MasterJson")
+	if avgBitrate == 0 {
+		avgBitrate = bitrate
 	}
 
-	return audio, nil
+	return int64(float64(avgBitrate) * duration / 8)
 }
 
-func (mj *MasterJson) FindMaximumBitrateVideo() *Video {
-	var video Video
-	for _, v := range mj.Video {
-		if v.Bitrate > video.Bitrate {
-			video = v
+// Trim drops the segments of every rendition which do not overlap the range
+// from start to end in seconds. end <= 0 means the end of the clip. It
+// returns the start time of the earliest remaining segment, which can be used
+// as the timestamp offset of ResumeTrackFileContext to make the files start
+// at zero.
+func (mj *MasterJson) Trim(start float64, end float64) (float64, error) {
+	return TrimTracks(mj.Tracks(), start, end)
+}
+
+// TrimTracks is Trim for the given tracks only, e.g. those which will be
+// downloaded, so that other renditions neither need to overlap the range nor
+// move the origin.
+func TrimTracks(tracks []Track, start float64, end float64) (float64, error) {
+	if end > 0 && end <= start {
+		return 0, fmt.Errorf("invalid time range %v-%v", start, end)
+	}
+
+	origin := math.Inf(1)
+	for _, track := range tracks {
+		stream := track.StreamInfo()
+		segments, err := trimSegments(stream.Segments, start, end)
+		if err != nil {
+			return 0, fmt.Errorf("%s %s: %w", track.Kind(), stream.Id, err)
 		}
+
+		track.SetSegments(segments, segmentsDuration(segments))
+		origin = math.Min(origin, segments[0].Start)
 	}
 
-	return &video
+	if math.IsInf(origin, 1) {
+		return 0, nil
+	}
+
+	return origin, nil
 }
 
-func (mj *MasterJson) FindMaximumBitrateAudio() *Audio {
-	var audio Audio
-	for _, a := range mj.Audio {
-		if a.Bitrate > audio.Bitrate {
-			audio = a
+func trimSegments(segments []Segment, start float64, end float64) ([]Segment, error) {
+	trimmed := []Segment{}
+	for _, s := range segments {
+		if s.End == 0 {
+			return nil, errors.New("segments have no start and end times")
 		}
+
+		if s.End > start && (end <= 0 || s.Start < end) {
+			trimmed = append(trimmed, s)
+		}
+	}
+
+	if len(trimmed) == 0 {
+		return nil, errors.New("no segments in the time range")
 	}
 
-	return &audio
+	return trimmed, nil
 }
 
-func (mj *MasterJson) VideoSegmentUrls(masterJsonUrl *url.URL, id string) ([]*url.URL, error) {
-	baseUrl, err := url.Parse(mj.BaseUrl)
+func segmentsDuration(segments []Segment) float64 {
+	return segments[len(segments)-1].End - segments[0].Start
+}
+
+func (mj *MasterJson) FindVideo(id string) (*Video, error) {
+	track, err := mj.FindTrack(VideoTrack, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return track.(*Video), nil
+}
+
+func (mj *MasterJson) FindAudio(id string) (*Audio, error) {
+	track, err := mj.FindTrack(AudioTrack, id)
 	if err != nil {
 		return nil, err
 	}
 
+	return track.(*Audio), nil
+}
+
+func (mj *MasterJson) FindMaximumBitrateVideo() *Video {
+	video, ok := mj.FindMaximumBitrateTrack(VideoTrack).(*Video)
+	if !ok {
+		return new(Video)
+	}
+
+	return video
+}
+
+func (mj *MasterJson) FindMaximumBitrateAudio() *Audio {
+	audio, ok := mj.FindMaximumBitrateTrack(AudioTrack).(*Audio)
+	if !ok {
+		return new(Audio)
+	}
+
+	return audio
+}
+
+func (mj *MasterJson) VideoSegmentUrls(masterJsonUrl *url.URL, id string) ([]*url.URL, error) {
 	video, err := mj.FindVideo(id)
 	if err != nil {
 		return nil, err
 	}
 
-	videoBaseUrl, err := url.Parse(video.BaseUrl)
+	return mj.SegmentUrls(masterJsonUrl, video)
+}
+
+func (mj *MasterJson) AudioSegmentUrls(masterJsonUrl *url.URL, id string) ([]*url.URL, error) {
+	audio, err := mj.FindAudio(id)
 	if err != nil {
 		return nil, err
 	}
 
-	urls := make([]*url.URL, len(video.Segments))
-	for i, s := range video.Segments {
-		segmentUrl, err := url.Parse(s.Url)
+	return mj.SegmentUrls(masterJsonUrl, audio)
+}
+
+// SegmentUrls resolves the urls of the segments of a track. A segment with a
+// byte range refers to a part of a single media file, which is requested
+// with a range query like the urls of query_string_ranges=1.
+func (mj *MasterJson) SegmentUrls(masterJsonUrl *url.URL, track Track) ([]*url.URL, error) {
+	stream := track.StreamInfo()
+	urls := make([]*url.URL, len(stream.Segments))
+	for i, s := range stream.Segments {
+		segmentUrl, err := mj.resolveUrl(masterJsonUrl, stream.BaseUrl, s.Url)
 		if err != nil {
 			return nil, err
 		}
 
-		urls[i] = masterJsonUrl.ResolveReference(baseUrl).ResolveReference(videoBaseUrl).ResolveReference(segmentUrl)
+		if len(s.Range) > 0 {
+			segmentUrl = withRange(segmentUrl, s.Range)
+		}
+
+		urls[i] = segmentUrl
 	}
 
 	return urls, nil
 }
 
-func (mj *MasterJson) AudioSegmentUrls(masterJsonUrl *url.URL, id string) ([]*url.URL, error) {
-	baseUrl, err := url.Parse(mj.BaseUrl)
+func (mj *MasterJson) resolveUrl(masterJsonUrl *url.URL, baseUrl string, ref string) (*url.URL, error) {
+	masterBaseUrl, err := url.Parse(mj.BaseUrl)
 	if err != nil {
 		return nil, err
 	}
 
-	audio, err := mj.FindAudio(id)
+	renditionBaseUrl, err := url.Parse(baseUrl)
 	if err != nil {
 		return nil, err
 	}
 
-	audioBaseUrl, err := url.Parse(audio.BaseUrl)
+	refUrl, err := url.Parse(ref)
 	if err != nil {
 		return nil, err
 	}
 
-	urls := make([]*url.URL, len(audio.Segments))
-	for i, s := range audio.Segments {
-		segmentUrl, err := url.Parse(s.Url)
-		if err != nil {
-			return nil, err
+	return masterJsonUrl.ResolveReference(masterBaseUrl).ResolveReference(renditionBaseUrl).ResolveReference(refUrl), nil
+}
+
+// hasEmbeddedInitSegments reports whether every init segment is embedded
+// as base64 or addressed by a byte range.
+func (mj *MasterJson) hasEmbeddedInitSegments() bool {
+	for _, track := range mj.Tracks() {
+		stream := track.StreamInfo()
+		if !isEmbeddedInitSegment(stream.InitSegment, stream.InitSegmentRange) {
+			return false
 		}
+	}
 
-		urls[i] = masterJsonUrl.ResolveReference(baseUrl).ResolveReference(audioBaseUrl).ResolveReference(segmentUrl)
+	return true
+}
+
+func isEmbeddedInitSegment(initSegment string, initSegmentRange string) bool {
+	if len(initSegment) == 0 {
+		return len(initSegmentRange) > 0
 	}
 
-	return urls, nil
+	_, err := base64.StdEncoding.DecodeString(initSegment)
+	return err == nil
 }
 
-func (mj *MasterJson) CreateVideoFile(output io.Writer, masterJsonUrl *url.URL, id string, client *Client) error {
-	video, err := mj.FindVideo(id)
-	if err != nil {
-		return err
+// isInitSegmentUrl reports whether init_segment is a url rather than
+// corrupt base64, which never contains '.', ':' or '?'.
+func isInitSegmentUrl(initSegment string) bool {
+	return strings.ContainsAny(initSegment, ".:?")
+}
+
+// initSegment returns the decoded init_segment. When init_segment is not
+// base64, it is downloaded as a url, and when it is missing,
+// init_segment_range is downloaded from the media file of the segments.
+func (mj *MasterJson) initSegment(ctx context.Context, masterJsonUrl *url.URL, stream Stream, client *Client) ([]byte, error) {
+	if len(stream.InitSegment) > 0 {
+		decoded, err := stream.DecodedInitSegment()
+		if err == nil || !isInitSegmentUrl(stream.InitSegment) {
+			return decoded, err
+		}
+
+		initSegmentUrl, urlErr := mj.resolveUrl(masterJsonUrl, stream.BaseUrl, stream.InitSegment)
+		if urlErr != nil {
+			return nil, err
+		}
+
+		return client.getBytes(ctx, "init segment", initSegmentUrl)
 	}
 
-	initSegment, err := video.DecodedInitSegment()
-	if err != nil {
-		return err
+	if len(stream.InitSegmentRange) == 0 {
+		return nil, errors.New("master.json has no init segment")
 	}
-	output.Write(initSegment)
 
-	videoSegmentUrls, err := mj.VideoSegmentUrls(masterJsonUrl, id)
-	if err != nil {
-		return err
+	ref := ""
+	if len(stream.Segments) > 0 {
+		ref = stream.Segments[0].Url
 	}
 
-	for _, videoSegmentUrl := range videoSegmentUrls {
-		fmt.Println("Downloading " + videoSegmentUrl.String())
-		err = client.Download(videoSegmentUrl, output)
-		if err != nil {
-			return err
-		}
+	mediaUrl, err := mj.resolveUrl(masterJsonUrl, stream.BaseUrl, ref)
+	if err != nil {
+		return nil, err
 	}
+	// the range of the first segment is replaced, while other parameters
+	// such as signatures are kept
+	query := mediaUrl.Query()
+	query.Del("range")
+	mediaUrl.RawQuery = query.Encode()
 
-	return nil
+	return client.getBytes(ctx, "init segment", withRange(mediaUrl, stream.InitSegmentRange))
+}
+
+func (mj *MasterJson) CreateVideoFile(output io.Writer, masterJsonUrl *url.URL, id string, client *Client) error {
+	return mj.CreateVideoFileContext(context.Background(), output, masterJsonUrl, id, client)
+}
+
+func (mj *MasterJson) CreateVideoFileContext(ctx context.Context, output io.Writer, masterJsonUrl *url.URL, id string, client *Client) error {
+	return mj.ResumeVideoFileContext(ctx, output, masterJsonUrl, id, client, new(TrackState), nil)
 }
 
 func (mj *MasterJson) CreateAudioFile(output io.Writer, masterJsonUrl *url.URL, id string, client *Client) error {
-	audio, err := mj.FindAudio(id)
-	if err != nil {
-		return err
-	}
+	return mj.CreateAudioFileContext(context.Background(), output, masterJsonUrl, id, client)
+}
+
+func (mj *MasterJson) CreateAudioFileContext(ctx context.Context, output io.Writer, masterJsonUrl *url.URL, id string, client *Client) error {
+	return mj.ResumeAudioFileContext(ctx, output, masterJsonUrl, id, client, new(TrackState), nil)
+}
+
+// ResumeVideoFile appends the parts of the video which are not recorded in
+// state to output. output must be positioned at state.Offset. onProgress is
+// called with the updated state after each segment is written.
+func (mj *MasterJson) ResumeVideoFile(output io.Writer, masterJsonUrl *url.URL, id string, client *Client, state *TrackState, onProgress func(*TrackState) error) error {
+	return mj.ResumeVideoFileContext(context.Background(), output, masterJsonUrl, id, client, state, onProgress)
+}
 
-	initSegment, err := audio.DecodedInitSegment()
+// ResumeVideoFileContext is ResumeVideoFile with a context. When ctx is done,
+// it returns ctx.Err() and state still describes what is in output, so that
+// the download can be resumed.
+func (mj *MasterJson) ResumeVideoFileContext(ctx context.Context, output io.Writer, masterJsonUrl *url.URL, id string, client *Client, state *TrackState, onProgress func(*TrackState) error) error {
+	video, err := mj.FindVideo(id)
 	if err != nil {
 		return err
 	}
-	output.Write(initSegment)
 
-	audioSegmentUrls, err := mj.AudioSegmentUrls(masterJsonUrl, id)
+	return mj.ResumeTrackFileContext(ctx, output, masterJsonUrl, video, client, 0, state, onProgress)
+}
+
+// ResumeAudioFile is the audio counterpart of ResumeVideoFile.
+func (mj *MasterJson) ResumeAudioFile(output io.Writer, masterJsonUrl *url.URL, id string, client *Client, state *TrackState, onProgress func(*TrackState) error) error {
+	return mj.ResumeAudioFileContext(context.Background(), output, masterJsonUrl, id, client, state, onProgress)
+}
+
+func (mj *MasterJson) ResumeAudioFileContext(ctx context.Context, output io.Writer, masterJsonUrl *url.URL, id string, client *Client, state *TrackState, onProgress func(*TrackState) error) error {
+	audio, err := mj.FindAudio(id)
 	if err != nil {
 		return err
 	}
 
-	for _, videoSegmentUrl := range audioSegmentUrls {
-		fmt.Println("Downloading " + videoSegmentUrl.String())
-		err = client.Download(videoSegmentUrl, output)
+	return mj.ResumeTrackFileContext(ctx, output, masterJsonUrl, audio, client, 0, state, onProgress)
+}
+
+// ResumeTrackFileContext is ResumeVideoFileContext for a track of any kind.
+// timestampOffset (in seconds) is subtracted from the timestamps of the
+// segments, e.g. the origin returned by Trim to make the file start at zero.
+func (mj *MasterJson) ResumeTrackFileContext(ctx context.Context, output io.Writer, masterJsonUrl *url.URL, track Track, client *Client, timestampOffset float64, state *TrackState, onProgress func(*TrackState) error) error {
+	stream := track.StreamInfo()
+	event := TrackEvent{Type: string(track.Kind()), Id: stream.Id, Segments: len(stream.Segments), EstimatedSize: stream.EstimatedSize()}
+	return client.observeTrack(event, state, func() error {
+		initSegment, err := mj.initSegment(ctx, masterJsonUrl, stream, client)
+		if err != nil {
+			return err
+		}
+
+		segmentUrls, err := mj.SegmentUrls(masterJsonUrl, track)
 		if err != nil {
 			return err
 		}
-	}
 
-	return nil
+		return client.resumeFile(ctx, event, output, initSegment, segmentUrls, timestampOffset, state, onProgress)
+	})
 }
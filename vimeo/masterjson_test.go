@@ -16,10 +16,14 @@ package vimeo
 
 import (
 	"bytes"
+	"encoding/base64"
+	"errors"
 	"net/http"
 	"net/url"
 	"reflect"
 	"testing"
+
+	"github.com/akiomik/vimeo-dl/vimeo/mp4"
 )
 
 func TestVideoDecodedInitSegment(t *testing.T) {
@@ -68,6 +72,50 @@ func TestAudioDecodedInitSegment(t *testing.T) {
 	}
 }
 
+func TestVideoInitSegmentInfo(t *testing.T) {
+	buf := new(bytes.Buffer)
+	(&mp4.Box{Type: "ftyp", Data: []byte("iso6\x00\x00\x00\x00iso6dash")}).WriteTo(buf)
+	masterJson := MasterJson{
+		Video: []Video{
+			Video{
+				Id:          "1080p",
+				InitSegment: base64.StdEncoding.EncodeToString(buf.Bytes()),
+			},
+		},
+	}
+	expected := &mp4.Ftyp{MajorBrand: "iso6", CompatibleBrands: []string{"iso6", "dash"}}
+
+	video, _ := masterJson.FindVideo("1080p")
+	info, err := video.InitSegmentInfo()
+	if err != nil {
+		t.Errorf("InitSegmentInfo failed to parse: %v", err)
+		return
+	}
+	if !reflect.DeepEqual(info.Ftyp, expected) {
+		t.Errorf("InitSegmentInfo ftyp does not match.\nexpected: %v\nactual:   %v", expected, info.Ftyp)
+		return
+	}
+}
+
+func TestVideoEstimatedSize(t *testing.T) {
+	cases := []struct {
+		video    Video
+		expected int64
+	}{
+		{Video{Segments: []Segment{Segment{Size: 100}, Segment{Size: 200}}}, 300},
+		{Video{AvgBitrate: 8000, Bitrate: 16000, Duration: 10, Segments: []Segment{Segment{Size: 100}, Segment{}}}, 10000},
+		{Video{Bitrate: 16000, Segments: []Segment{Segment{Start: 0, End: 6}, Segment{Start: 6, End: 10}}}, 20000},
+		{Video{}, 0},
+	}
+
+	for _, c := range cases {
+		actual := c.video.EstimatedSize()
+		if actual != c.expected {
+			t.Errorf("EstimatedSize does not match.\nexpected: %v\nactual:   %v", c.expected, actual)
+		}
+	}
+}
+
 func TestFindVideo(t *testing.T) {
 	masterJson := MasterJson{
 		Video: []Video{
@@ -382,3 +430,395 @@ func TestCreateAudioFile(t *testing.T) {
 		return
 	}
 }
+
+func TestResumeVideoFile(t *testing.T) {
+	masterJson := MasterJson{
+		BaseUrl: "../",
+		Video: []Video{
+			Video{
+				Id:          "qux",
+				BaseUrl:     "qux/chop/",
+				InitSegment: "Zm9vYmFyYmF6cXV4Cg==",
+				Segments: []Segment{
+					Segment{Url: "segment-1.m4s"},
+					Segment{Url: "segment-2.m4s"},
+					Segment{Url: "segment-3.m4s"},
+				},
+			},
+		},
+	}
+	url2, _ := url.Parse("https://example.com/foo/bar/video/qux/chop/segment-3.m4s")
+	body2 := []byte("ABCDEFGHIJ")
+	expected := []byte("ABCDEFGHIJ")
+	expectedStates := []TrackState{TrackState{Segments: 3, Offset: 43}}
+
+	masterJsonUrl, _ := url.Parse("https://example.com/foo/bar/video/baz/master.json")
+	output := new(bytes.Buffer)
+	client := NewClient()
+	client.Client = NewMockClient(func(req *http.Request) *http.Response {
+		if *req.URL == *url2 {
+			return NewMockReponseFromBytes(body2)
+		}
+
+		t.Errorf("MockClient got unexpected request url: %v", req.URL.String())
+		return nil
+	})
+
+	state := &TrackState{Segments: 2, Offset: 33}
+	actualStates := []TrackState{}
+	err := masterJson.ResumeVideoFile(output, masterJsonUrl, "qux", client, state, func(s *TrackState) error {
+		actualStates = append(actualStates, *s)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("ResumeVideoFile failed to resume video: %v", err)
+		return
+	}
+
+	actual := output.Bytes()
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("ResumeVideoFile output does not match.\nexpected: %v\nactual:   %v", expected, actual)
+		return
+	}
+
+	if !reflect.DeepEqual(expectedStates, actualStates) {
+		t.Errorf("ResumeVideoFile states do not match.\nexpected: %v\nactual:   %v", expectedStates, actualStates)
+		return
+	}
+}
+
+func TestMasterJsonTrim(t *testing.T) {
+	masterJson := MasterJson{
+		Video: []Video{
+			Video{
+				Id:       "1080p",
+				Duration: 24,
+				Segments: []Segment{
+					Segment{Url: "segment-1.m4s", Start: 0, End: 6},
+					Segment{Url: "segment-2.m4s", Start: 6, End: 12},
+					Segment{Url: "segment-3.m4s", Start: 12, End: 18},
+					Segment{Url: "segment-4.m4s", Start: 18, End: 24},
+				},
+			},
+		},
+		Audio: []Audio{
+			Audio{
+				Id: "audio",
+				Segments: []Segment{
+					Segment{Url: "segment-1.m4s", Start: 0, End: 4},
+					Segment{Url: "segment-2.m4s", Start: 4, End: 8},
+					Segment{Url: "segment-3.m4s", Start: 8, End: 12},
+					Segment{Url: "segment-4.m4s", Start: 12, End: 16},
+				},
+			},
+		},
+	}
+	expectedVideo := []Segment{
+		Segment{Url: "segment-2.m4s", Start: 6, End: 12},
+		Segment{Url: "segment-3.m4s", Start: 12, End: 18},
+	}
+	expectedAudio := []Segment{
+		Segment{Url: "segment-2.m4s", Start: 4, End: 8},
+		Segment{Url: "segment-3.m4s", Start: 8, End: 12},
+		Segment{Url: "segment-4.m4s", Start: 12, End: 16},
+	}
+
+	origin, err := masterJson.Trim(7, 13)
+	if err != nil {
+		t.Errorf("Trim failed: %v", err)
+		return
+	}
+
+	if origin != 4 {
+		t.Errorf("Trim origin does not match.\nexpected: %v\nactual:   %v", 4, origin)
+	}
+
+	if !reflect.DeepEqual(expectedVideo, masterJson.Video[0].Segments) {
+		t.Errorf("Trim video segments do not match.\nexpected: %v\nactual:   %v", expectedVideo, masterJson.Video[0].Segments)
+	}
+
+	if !reflect.DeepEqual(expectedAudio, masterJson.Audio[0].Segments) {
+		t.Errorf("Trim audio segments do not match.\nexpected: %v\nactual:   %v", expectedAudio, masterJson.Audio[0].Segments)
+	}
+
+	if masterJson.Video[0].Duration != 12 {
+		t.Errorf("Trim video duration does not match.\nexpected: %v\nactual:   %v", 12, masterJson.Video[0].Duration)
+	}
+}
+
+func TestTrimTracks(t *testing.T) {
+	masterJson := MasterJson{
+		Video: []Video{
+			Video{
+				Id: "1080p",
+				Segments: []Segment{
+					Segment{Url: "segment-1.m4s", Start: 0, End: 6},
+					Segment{Url: "segment-2.m4s", Start: 6, End: 12},
+				},
+			},
+		},
+		Audio: []Audio{
+			Audio{
+				Id: "audio",
+				Segments: []Segment{
+					Segment{Url: "segment-1.m4s", Start: 0, End: 4},
+					Segment{Url: "segment-2.m4s", Start: 4, End: 8},
+				},
+			},
+		},
+	}
+
+	origin, err := TrimTracks([]Track{&masterJson.Video[0]}, 7, 0)
+	if err != nil {
+		t.Errorf("TrimTracks failed: %v", err)
+		return
+	}
+
+	if origin != 6 {
+		t.Errorf("TrimTracks origin does not match.\nexpected: %v\nactual:   %v", 6, origin)
+	}
+
+	if len(masterJson.Video[0].Segments) != 1 || len(masterJson.Audio[0].Segments) != 2 {
+		t.Errorf("TrimTracks must trim only the given tracks: %v", masterJson)
+	}
+}
+
+func TestMasterJsonTrimWithInvalidRange(t *testing.T) {
+	newMasterJson := func() MasterJson {
+		return MasterJson{
+			Video: []Video{
+				Video{
+					Id: "1080p",
+					Segments: []Segment{
+						Segment{Url: "segment-1.m4s", Start: 0, End: 6},
+						Segment{Url: "segment-2.m4s", Start: 6, End: 12},
+					},
+				},
+			},
+		}
+	}
+
+	cases := []struct {
+		start float64
+		end   float64
+	}{
+		{10, 5},
+		{12, 0},
+		{30, 40},
+	}
+
+	for _, c := range cases {
+		masterJson := newMasterJson()
+		_, err := masterJson.Trim(c.start, c.end)
+		if err == nil {
+			t.Errorf("Trim must fail for %v-%v", c.start, c.end)
+		}
+	}
+
+	masterJson := MasterJson{
+		Video: []Video{
+			Video{Id: "1080p", Segments: []Segment{Segment{Url: "segment-1.m4s"}}},
+		},
+	}
+	_, err := masterJson.Trim(0, 10)
+	if err == nil {
+		t.Errorf("Trim must fail without segment times")
+	}
+}
+
+func TestCreateVideoFileWithByteRanges(t *testing.T) {
+	masterJson := MasterJson{
+		BaseUrl: "../../../parcel/",
+		Video: []Video{
+			Video{
+				Id:               "1080p",
+				BaseUrl:          "1080p.mp4",
+				InitSegmentRange: "0-12",
+				Segments: []Segment{
+					Segment{Url: "", Range: "13-22"},
+					Segment{Url: "", Range: "23-32"},
+				},
+			},
+		},
+	}
+	expectedUrls := []string{
+		"https://example.com/foo/parcel/1080p.mp4?range=0-12",
+		"https://example.com/foo/parcel/1080p.mp4?range=13-22",
+		"https://example.com/foo/parcel/1080p.mp4?range=23-32",
+	}
+	bodies := []string{"foobarbazqux\x0a", "0123456789", "abcdefghij"}
+	expected := []byte("foobarbazqux\x0a0123456789abcdefghij")
+
+	masterJsonUrl, _ := url.Parse("https://example.com/foo/bar/baz/qux/master.json")
+	output := new(bytes.Buffer)
+	client := NewClient()
+	client.Client = NewMockClient(func(req *http.Request) *http.Response {
+		for i, u := range expectedUrls {
+			if req.URL.String() == u {
+				return NewMockReponseFromString(bodies[i])
+			}
+		}
+
+		t.Errorf("MockClient got unexpected request url: %v", req.URL.String())
+		return NewMockReponseWithStatus(http.StatusNotFound, "")
+	})
+
+	err := masterJson.CreateVideoFile(output, masterJsonUrl, "1080p", client)
+	if err != nil {
+		t.Errorf("CreateVideoFile failed to create video: %v", err)
+		return
+	}
+
+	actual := output.Bytes()
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("CreateVideoFile output does not match.\nexpected: %v\nactual:   %v", expected, actual)
+		return
+	}
+}
+
+func TestCreateVideoFileWithSignedByteRanges(t *testing.T) {
+	masterJson := MasterJson{
+		BaseUrl: "../",
+		Video: []Video{
+			Video{
+				Id:               "1080p",
+				BaseUrl:          "parcel/",
+				InitSegmentRange: "0-12",
+				Segments: []Segment{
+					Segment{Url: "1080p.mp4?range=13-22&token=abc"},
+					Segment{Url: "1080p.mp4?range=23-32&token=abc"},
+				},
+			},
+		},
+	}
+	expectedUrls := []string{
+		"https://example.com/foo/parcel/1080p.mp4?range=0-12&token=abc",
+		"https://example.com/foo/parcel/1080p.mp4?range=13-22&token=abc",
+		"https://example.com/foo/parcel/1080p.mp4?range=23-32&token=abc",
+	}
+	bodies := []string{"foobarbazqux\x0a", "0123456789", "abcdefghij"}
+	expected := []byte("foobarbazqux\x0a0123456789abcdefghij")
+
+	masterJsonUrl, _ := url.Parse("https://example.com/foo/bar/master.json")
+	output := new(bytes.Buffer)
+	client := NewClient()
+	client.Client = NewMockClient(func(req *http.Request) *http.Response {
+		for i, u := range expectedUrls {
+			if req.URL.String() == u {
+				return NewMockReponseFromString(bodies[i])
+			}
+		}
+
+		t.Errorf("MockClient got unexpected request url: %v", req.URL.String())
+		return NewMockReponseWithStatus(http.StatusNotFound, "")
+	})
+
+	err := masterJson.CreateVideoFile(output, masterJsonUrl, "1080p", client)
+	if err != nil {
+		t.Errorf("CreateVideoFile failed to create video: %v", err)
+		return
+	}
+
+	actual := output.Bytes()
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("CreateVideoFile output does not match.\nexpected: %v\nactual:   %v", expected, actual)
+		return
+	}
+}
+
+func TestCreateVideoFileWithInitSegmentUrl(t *testing.T) {
+	masterJson := MasterJson{
+		BaseUrl: "../",
+		Video: []Video{
+			Video{
+				Id:          "1080p",
+				BaseUrl:     "1080p/chop/",
+				InitSegment: "segment-0.m4s",
+				Segments: []Segment{
+					Segment{Url: "segment-1.m4s"},
+				},
+			},
+		},
+	}
+	expectedUrls := []string{
+		"https://example.com/foo/1080p/chop/segment-0.m4s",
+		"https://example.com/foo/1080p/chop/segment-1.m4s",
+	}
+	bodies := []string{"foobarbazqux\x0a", "0123456789"}
+	expected := []byte("foobarbazqux\x0a0123456789")
+
+	masterJsonUrl, _ := url.Parse("https://example.com/foo/bar/master.json")
+	output := new(bytes.Buffer)
+	client := NewClient()
+	client.Client = NewMockClient(func(req *http.Request) *http.Response {
+		for i, u := range expectedUrls {
+			if req.URL.String() == u {
+				return NewMockReponseFromString(bodies[i])
+			}
+		}
+
+		t.Errorf("MockClient got unexpected request url: %v", req.URL.String())
+		return NewMockReponseWithStatus(http.StatusNotFound, "")
+	})
+
+	err := masterJson.CreateVideoFile(output, masterJsonUrl, "1080p", client)
+	if err != nil {
+		t.Errorf("CreateVideoFile failed to create video: %v", err)
+		return
+	}
+
+	actual := output.Bytes()
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("CreateVideoFile output does not match.\nexpected: %v\nactual:   %v", expected, actual)
+		return
+	}
+}
+
+func TestCreateVideoFileWithCorruptInitSegment(t *testing.T) {
+	masterJson := MasterJson{
+		Video: []Video{
+			Video{
+				Id:          "1080p",
+				InitSegment: "Zm9vYmFy!!",
+				Segments:    []Segment{Segment{Url: "segment-1.m4s"}},
+			},
+		},
+	}
+
+	requests := 0
+	client := NewClient()
+	client.Client = NewMockClient(func(req *http.Request) *http.Response {
+		requests++
+		return NewMockReponseWithStatus(http.StatusNotFound, "")
+	})
+
+	masterJsonUrl, _ := url.Parse("https://example.com/foo/master.json")
+	err := masterJson.CreateVideoFile(new(bytes.Buffer), masterJsonUrl, "1080p", client)
+	var corruptErr base64.CorruptInputError
+	if !errors.As(err, &corruptErr) {
+		t.Errorf("CreateVideoFile must fail with the decode error: %v", err)
+		return
+	}
+
+	if requests != 0 {
+		t.Errorf("CreateVideoFile must not fetch corrupt base64 as a url: %d requests", requests)
+		return
+	}
+}
+
+func TestParseMasterJson(t *testing.T) {
+	masterJson, err := ParseMasterJson([]byte(`{"clip_id":"foo","base_url":"../","video":[{"id":"bar","segments":[{"url":"segment-1.m4s"}]}]}`))
+	if err != nil {
+		t.Errorf("ParseMasterJson failed: %v", err)
+		return
+	}
+
+	if masterJson.ClipId != "foo" || len(masterJson.Video) != 1 || masterJson.Video[0].Segments[0].Url != "segment-1.m4s" {
+		t.Errorf("ParseMasterJson does not match: %v", masterJson)
+	}
+
+	_, err = ParseMasterJson([]byte(`{"clip_id":`))
+	if err == nil {
+		t.Errorf("ParseMasterJson must fail for invalid json")
+	}
+}
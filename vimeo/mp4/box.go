@@ -0,0 +1,296 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mp4
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+var ErrShortBox = errors.New("mp4: box is too short")
+
+// containerTypes are the boxes whose payload is a list of child boxes.
+var containerTypes = map[string]bool{
+	"moov": true,
+	"trak": true,
+	"mdia": true,
+	"minf": true,
+	"stbl": true,
+	"mvex": true,
+	"edts": true,
+	"dinf": true,
+	"moof": true,
+	"traf": true,
+	"mfra": true,
+	"sinf": true,
+	"schi": true,
+}
+
+// Header is the size and type of a box. Size includes the header itself and
+// is 0 for a box which extends to the end of the file.
+type Header struct {
+	Type       string
+	Size       int64
+	HeaderSize int64
+}
+
+func (h *Header) PayloadSize() int64 {
+	return h.Size - h.HeaderSize
+}
+
+// Box is an ISO-BMFF box held in memory. Container boxes have Children and
+// other boxes keep their raw payload in Data.
+type Box struct {
+	Type     string
+	Data     []byte
+	Children []*Box
+
+	// largeSize keeps a 64-bit size header on rewrite, so that the box
+	// size (and offsets relative to it) does not change.
+	largeSize bool
+}
+
+func ReadHeader(r io.Reader) (*Header, error) {
+	buf := make([]byte, 8)
+	_, err := io.ReadFull(r, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	header := &Header{
+		Type:       string(buf[4:8]),
+		Size:       int64(binary.BigEndian.Uint32(buf[0:4])),
+		HeaderSize: 8,
+	}
+
+	if header.Size == 1 {
+		_, err = io.ReadFull(r, buf)
+		if err != nil {
+			return nil, err
+		}
+
+		largeSize := binary.BigEndian.Uint64(buf)
+		if largeSize > math.MaxInt64 {
+			return nil, fmt.Errorf("mp4: '%s' box is too large", header.Type)
+		}
+		header.Size = int64(largeSize)
+		header.HeaderSize = 16
+	}
+
+	if header.Size != 0 && header.Size < header.HeaderSize {
+		return nil, fmt.Errorf("mp4: '%s' box has invalid size %d", header.Type, header.Size)
+	}
+
+	return header, nil
+}
+
+// ReadBox reads a whole box including its payload. It should not be used
+// for mdat, which may be arbitrarily large.
+func ReadBox(r io.Reader) (*Box, error) {
+	header, err := ReadHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return ReadBoxPayload(r, header)
+}
+
+func ReadBoxPayload(r io.Reader, header *Header) (*Box, error) {
+	var data []byte
+	var err error
+	if header.Size == 0 {
+		data, err = io.ReadAll(r)
+	} else {
+		data = make([]byte, header.PayloadSize())
+		_, err = io.ReadFull(r, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	box, err := newBox(header.Type, data)
+	if err != nil {
+		return nil, err
+	}
+	box.largeSize = header.HeaderSize == 16
+
+	return box, nil
+}
+
+// ParseBoxes parses consecutive boxes in data.
+func ParseBoxes(data []byte) ([]*Box, error) {
+	boxes := []*Box{}
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return nil, ErrShortBox
+		}
+
+		size := int64(binary.BigEndian.Uint32(data[0:4]))
+		typ := string(data[4:8])
+		headerSize := int64(8)
+		if size == 1 {
+			if len(data) < 16 {
+				return nil, ErrShortBox
+			}
+			largeSize := binary.BigEndian.Uint64(data[8:16])
+			if largeSize > math.MaxInt64 {
+				return nil, ErrShortBox
+			}
+			size = int64(largeSize)
+			headerSize = 16
+		} else if size == 0 {
+			size = int64(len(data))
+		}
+
+		if size < headerSize || size > int64(len(data)) {
+			return nil, fmt.Errorf("mp4: '%s' box has invalid size %d", typ, size)
+		}
+
+		box, err := newBox(typ, data[headerSize:size])
+		if err != nil {
+			return nil, err
+		}
+		box.largeSize = headerSize == 16
+		boxes = append(boxes, box)
+
+		data = data[size:]
+	}
+
+	return boxes, nil
+}
+
+func newBox(typ string, data []byte) (*Box, error) {
+	if !containerTypes[typ] {
+		return &Box{Type: typ, Data: data}, nil
+	}
+
+	children, err := ParseBoxes(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Box{Type: typ, Children: children}, nil
+}
+
+func (b *Box) IsContainer() bool {
+	return containerTypes[b.Type] || len(b.Children) > 0
+}
+
+func (b *Box) payloadSize() int64 {
+	if !b.IsContainer() {
+		return int64(len(b.Data))
+	}
+
+	var size int64
+	for _, c := range b.Children {
+		size += c.Size()
+	}
+
+	return size
+}
+
+// Size returns the encoded size of the box including its header.
+func (b *Box) Size() int64 {
+	payloadSize := b.payloadSize()
+	if b.largeSize || payloadSize+8 > math.MaxUint32 {
+		return payloadSize + 16
+	}
+
+	return payloadSize + 8
+}
+
+// Child returns the first child box of the given type, or nil.
+func (b *Box) Child(typ string) *Box {
+	for _, c := range b.Children {
+		if c.Type == typ {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// Find follows a path of box types, e.g. Find("mdia", "mdhd") on a trak.
+func (b *Box) Find(path ...string) *Box {
+	box := b
+	for _, typ := range path {
+		box = box.Child(typ)
+		if box == nil {
+			return nil
+		}
+	}
+
+	return box
+}
+
+// ChildrenOf returns every child box of the given type.
+func (b *Box) ChildrenOf(typ string) []*Box {
+	boxes := []*Box{}
+	for _, c := range b.Children {
+		if c.Type == typ {
+			boxes = append(boxes, c)
+		}
+	}
+
+	return boxes
+}
+
+// WriteHeader writes a box header for a box of the given total size. A
+// 64-bit size is used when the size does not fit in 32 bits or large is set.
+func WriteHeader(w io.Writer, typ string, size int64, large bool) (int64, error) {
+	if len(typ) != 4 {
+		return 0, fmt.Errorf("mp4: invalid box type '%s'", typ)
+	}
+
+	var buf []byte
+	if large || size > math.MaxUint32 {
+		buf = make([]byte, 16)
+		binary.BigEndian.PutUint32(buf[0:4], 1)
+		binary.BigEndian.PutUint64(buf[8:16], uint64(size))
+	} else {
+		buf = make([]byte, 8)
+		binary.BigEndian.PutUint32(buf[0:4], uint32(size))
+	}
+	copy(buf[4:8], typ)
+
+	n, err := w.Write(buf)
+	return int64(n), err
+}
+
+func (b *Box) WriteTo(w io.Writer) (int64, error) {
+	size := b.Size()
+	written, err := WriteHeader(w, b.Type, size, size-b.payloadSize() == 16)
+	if err != nil {
+		return written, err
+	}
+
+	if !b.IsContainer() {
+		n, err := w.Write(b.Data)
+		return written + int64(n), err
+	}
+
+	for _, c := range b.Children {
+		n, err := c.WriteTo(w)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
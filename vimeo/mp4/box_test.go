@@ -0,0 +1,81 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mp4
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestParseBoxesAndWriteTo(t *testing.T) {
+	data := []byte{
+		0, 0, 0, 16, 'f', 't', 'y', 'p', 'i', 's', 'o', '6', 0, 0, 0, 0,
+		0, 0, 0, 24, 'm', 'o', 'o', 'f',
+		0, 0, 0, 16, 'm', 'f', 'h', 'd', 0, 0, 0, 0, 0, 0, 0, 7,
+		0, 0, 0, 1, 'm', 'd', 'a', 't', 0, 0, 0, 0, 0, 0, 0, 19, 'a', 'b', 'c',
+	}
+
+	boxes, err := ParseBoxes(data)
+	if err != nil {
+		t.Errorf("ParseBoxes failed: %v", err)
+		return
+	}
+
+	expected := []*Box{
+		{Type: "ftyp", Data: []byte("iso6\x00\x00\x00\x00")},
+		{Type: "moof", Children: []*Box{{Type: "mfhd", Data: []byte{0, 0, 0, 0, 0, 0, 0, 7}}}},
+		{Type: "mdat", Data: []byte("abc"), largeSize: true},
+	}
+	if !reflect.DeepEqual(expected, boxes) {
+		t.Errorf("ParseBoxes boxes do not match.\nexpected: %v\nactual:   %v", expected, boxes)
+		return
+	}
+
+	output := new(bytes.Buffer)
+	for _, b := range boxes {
+		b.WriteTo(output)
+	}
+	if !bytes.Equal(data, output.Bytes()) {
+		t.Errorf("WriteTo output does not match.\nexpected: %v\nactual:   %v", data, output.Bytes())
+		return
+	}
+}
+
+func TestParseBoxesWithInvalidSize(t *testing.T) {
+	data := []byte{0, 0, 0, 32, 'f', 't', 'y', 'p', 'i', 's', 'o', '6'}
+
+	_, err := ParseBoxes(data)
+	if err == nil {
+		t.Errorf("ParseBoxes must fail when a box exceeds data")
+		return
+	}
+}
+
+func TestReadBox(t *testing.T) {
+	data := []byte{0, 0, 0, 12, 'f', 'r', 'e', 'e', 1, 2, 3, 4, 0xff}
+
+	box, err := ReadBox(bytes.NewReader(data))
+	if err != nil {
+		t.Errorf("ReadBox failed: %v", err)
+		return
+	}
+
+	expected := &Box{Type: "free", Data: []byte{1, 2, 3, 4}}
+	if !reflect.DeepEqual(expected, box) {
+		t.Errorf("ReadBox box does not match.\nexpected: %v\nactual:   %v", expected, box)
+		return
+	}
+}
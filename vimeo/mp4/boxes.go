@@ -0,0 +1,619 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mp4
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Ftyp struct {
+	MajorBrand       string
+	MinorVersion     uint32
+	CompatibleBrands []string
+}
+
+type Mvhd struct {
+	Timescale   uint32
+	Duration    uint64
+	NextTrackId uint32
+}
+
+type Tkhd struct {
+	TrackId  uint32
+	Duration uint64
+	Width    float64
+	Height   float64
+}
+
+type Mdhd struct {
+	Timescale uint32
+	Duration  uint64
+	Language  string
+}
+
+type Hdlr struct {
+	HandlerType string
+	Name        string
+}
+
+// SampleEntry is an entry of stsd. Width and Height are set for visual
+// entries, and ChannelCount, SampleSize and SampleRate for audio entries.
+type SampleEntry struct {
+	Format       string
+	Codec        string
+	Width        uint16
+	Height       uint16
+	ChannelCount uint16
+	SampleSize   uint16
+	SampleRate   uint32
+}
+
+type Trex struct {
+	TrackId                       uint32
+	DefaultSampleDescriptionIndex uint32
+	DefaultSampleDuration         uint32
+	DefaultSampleSize             uint32
+	DefaultSampleFlags            uint32
+}
+
+type SidxReference struct {
+	ReferenceType      uint8
+	ReferencedSize     uint32
+	SubsegmentDuration uint32
+	StartsWithSap      bool
+	SapType            uint8
+	SapDeltaTime       uint32
+}
+
+type Sidx struct {
+	ReferenceId              uint32
+	Timescale                uint32
+	EarliestPresentationTime uint64
+	FirstOffset              uint64
+	References               []SidxReference
+}
+
+type Mfhd struct {
+	SequenceNumber uint32
+}
+
+const (
+	TfhdBaseDataOffsetPresent         = 0x000001
+	TfhdSampleDescriptionIndexPresent = 0x000002
+	TfhdDefaultSampleDurationPresent  = 0x000008
+	TfhdDefaultSampleSizePresent      = 0x000010
+	TfhdDefaultSampleFlagsPresent     = 0x000020
+	TfhdDurationIsEmpty               = 0x010000
+	TfhdDefaultBaseIsMoof             = 0x020000
+)
+
+type Tfhd struct {
+	Flags                  uint32
+	TrackId                uint32
+	BaseDataOffset         uint64
+	SampleDescriptionIndex uint32
+	DefaultSampleDuration  uint32
+	DefaultSampleSize      uint32
+	DefaultSampleFlags     uint32
+}
+
+type Tfdt struct {
+	BaseMediaDecodeTime uint64
+}
+
+const (
+	TrunDataOffsetPresent                  = 0x000001
+	TrunFirstSampleFlagsPresent            = 0x000004
+	TrunSampleDurationPresent              = 0x000100
+	TrunSampleSizePresent                  = 0x000200
+	TrunSampleFlagsPresent                 = 0x000400
+	TrunSampleCompositionTimeOffsetPresent = 0x000800
+)
+
+// MaxTrunSamples bounds the sample count of a trun whose samples carry no
+// fields, since the payload size cannot bound it then.
+const MaxTrunSamples = 1 << 20
+
+type TrunSample struct {
+	Duration              uint32
+	Size                  uint32
+	Flags                 uint32
+	CompositionTimeOffset int64
+}
+
+type Trun struct {
+	Flags            uint32
+	DataOffset       int32
+	FirstSampleFlags uint32
+	Samples          []TrunSample
+}
+
+func checkType(b *Box, typ string) error {
+	if b.Type != typ {
+		return fmt.Errorf("mp4: expected '%s' box but got '%s'", typ, b.Type)
+	}
+
+	return nil
+}
+
+func ParseFtyp(b *Box) (*Ftyp, error) {
+	if b.Type != "ftyp" && b.Type != "styp" {
+		return nil, fmt.Errorf("mp4: expected 'ftyp' box but got '%s'", b.Type)
+	}
+
+	r := newFieldReader(b.Data)
+	ftyp := &Ftyp{
+		MajorBrand:       r.fourCC(),
+		MinorVersion:     r.uint32(),
+		CompatibleBrands: []string{},
+	}
+	for r.err == nil && r.remaining() >= 4 {
+		ftyp.CompatibleBrands = append(ftyp.CompatibleBrands, r.fourCC())
+	}
+
+	return ftyp, r.err
+}
+
+func ParseMvhd(b *Box) (*Mvhd, error) {
+	if err := checkType(b, "mvhd"); err != nil {
+		return nil, err
+	}
+
+	r := newFieldReader(b.Data)
+	version, _ := r.fullBox()
+	wide := version == 1
+	mvhd := new(Mvhd)
+	r.uint(wide) // creation_time
+	r.uint(wide) // modification_time
+	mvhd.Timescale = r.uint32()
+	mvhd.Duration = r.uint(wide)
+	r.skip(4 + 2 + 10 + 36 + 24) // rate, volume, reserved, matrix, pre_defined
+	mvhd.NextTrackId = r.uint32()
+
+	return mvhd, r.err
+}
+
+func ParseTkhd(b *Box) (*Tkhd, error) {
+	if err := checkType(b, "tkhd"); err != nil {
+		return nil, err
+	}
+
+	r := newFieldReader(b.Data)
+	version, _ := r.fullBox()
+	wide := version == 1
+	tkhd := new(Tkhd)
+	r.uint(wide) // creation_time
+	r.uint(wide) // modification_time
+	tkhd.TrackId = r.uint32()
+	r.skip(4) // reserved
+	tkhd.Duration = r.uint(wide)
+	r.skip(8 + 2 + 2 + 2 + 2 + 36) // reserved, layer, alternate_group, volume, reserved, matrix
+	tkhd.Width = float64(r.uint32()) / 65536
+	tkhd.Height = float64(r.uint32()) / 65536
+
+	return tkhd, r.err
+}
+
+func ParseMdhd(b *Box) (*Mdhd, error) {
+	if err := checkType(b, "mdhd"); err != nil {
+		return nil, err
+	}
+
+	r := newFieldReader(b.Data)
+	version, _ := r.fullBox()
+	wide := version == 1
+	mdhd := new(Mdhd)
+	r.uint(wide) // creation_time
+	r.uint(wide) // modification_time
+	mdhd.Timescale = r.uint32()
+	mdhd.Duration = r.uint(wide)
+
+	language := r.uint16()
+	mdhd.Language = string([]byte{
+		byte(language>>10&0x1f) + 0x60,
+		byte(language>>5&0x1f) + 0x60,
+		byte(language&0x1f) + 0x60,
+	})
+
+	return mdhd, r.err
+}
+
+func ParseHdlr(b *Box) (*Hdlr, error) {
+	if err := checkType(b, "hdlr"); err != nil {
+		return nil, err
+	}
+
+	r := newFieldReader(b.Data)
+	r.fullBox()
+	r.skip(4) // pre_defined
+	hdlr := &Hdlr{HandlerType: r.fourCC()}
+	r.skip(12) // reserved
+	if r.err == nil {
+		hdlr.Name = strings.TrimRight(string(r.bytes(r.remaining())), "\x00")
+	}
+
+	return hdlr, r.err
+}
+
+// ParseStsd parses the sample entries of stsd. handlerType (from hdlr)
+// tells whether the entries are visual or audio.
+func ParseStsd(b *Box, handlerType string) ([]*SampleEntry, error) {
+	if err := checkType(b, "stsd"); err != nil {
+		return nil, err
+	}
+
+	r := newFieldReader(b.Data)
+	r.fullBox()
+	r.uint32() // entry_count
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	boxes, err := ParseBoxes(r.bytes(r.remaining()))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*SampleEntry, len(boxes))
+	for i, box := range boxes {
+		entry, err := parseSampleEntry(box, handlerType)
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = entry
+	}
+
+	return entries, nil
+}
+
+func parseSampleEntry(b *Box, handlerType string) (*SampleEntry, error) {
+	entry := &SampleEntry{Format: b.Type}
+
+	r := newFieldReader(b.Data)
+	r.skip(6 + 2) // reserved, data_reference_index
+
+	switch handlerType {
+	case "vide":
+		r.skip(2 + 2 + 12) // pre_defined, reserved, pre_defined
+		entry.Width = r.uint16()
+		entry.Height = r.uint16()
+		r.skip(4 + 4 + 4 + 2 + 32 + 2 + 2) // resolutions, reserved, frame_count, compressorname, depth, pre_defined
+	case "soun":
+		r.skip(8) // reserved
+		entry.ChannelCount = r.uint16()
+		entry.SampleSize = r.uint16()
+		r.skip(2 + 2) // pre_defined, reserved
+		entry.SampleRate = r.uint32() >> 16
+	default:
+		entry.Codec = entry.Format
+		return entry, nil
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	// codec configuration boxes follow; ignore trailing garbage
+	children, err := ParseBoxes(r.bytes(r.remaining()))
+	if err != nil {
+		children = []*Box{}
+	}
+	config := &Box{Type: b.Type, Children: children}
+
+	format := entry.Format
+	if frma := config.Find("sinf", "frma"); frma != nil && len(frma.Data) >= 4 {
+		// encrypted entries (encv, enca) keep the original format in frma
+		format = string(frma.Data[0:4])
+	}
+
+	entry.Codec = codecString(format, config)
+	return entry, nil
+}
+
+func codecString(format string, config *Box) string {
+	switch format {
+	case "avc1", "avc2", "avc3", "avc4":
+		if avcC := config.Child("avcC"); avcC != nil && len(avcC.Data) >= 4 {
+			return fmt.Sprintf("%s.%02x%02x%02x", format, avcC.Data[1], avcC.Data[2], avcC.Data[3])
+		}
+	case "hvc1", "hev1":
+		if hvcC := config.Child("hvcC"); hvcC != nil {
+			if codec, ok := hevcCodecString(format, hvcC.Data); ok {
+				return codec
+			}
+		}
+	case "vp08", "vp09":
+		if vpcC := config.Child("vpcC"); vpcC != nil && len(vpcC.Data) >= 7 {
+			return fmt.Sprintf("%s.%02d.%02d.%02d", format, vpcC.Data[4], vpcC.Data[5], vpcC.Data[6]>>4)
+		}
+	case "av01":
+		if av1C := config.Child("av1C"); av1C != nil && len(av1C.Data) >= 3 {
+			profile := av1C.Data[1] >> 5
+			level := av1C.Data[1] & 0x1f
+			tier := "M"
+			if av1C.Data[2]&0x80 != 0 {
+				tier = "H"
+			}
+			bitDepth := 8
+			if av1C.Data[2]&0x40 != 0 {
+				bitDepth = 10
+				if av1C.Data[2]&0x20 != 0 {
+					bitDepth = 12
+				}
+			}
+			return fmt.Sprintf("av01.%d.%02d%s.%02d", profile, level, tier, bitDepth)
+		}
+	case "mp4a":
+		if esds := config.Child("esds"); esds != nil {
+			if codec, ok := mp4aCodecString(esds.Data); ok {
+				return codec
+			}
+		}
+	}
+
+	return format
+}
+
+func hevcCodecString(format string, data []byte) (string, bool) {
+	if len(data) < 13 {
+		return "", false
+	}
+
+	profileSpace := []string{"", "A", "B", "C"}[data[1]>>6]
+	tier := "L"
+	if data[1]&0x20 != 0 {
+		tier = "H"
+	}
+	profile := data[1] & 0x1f
+
+	// compatibility flags are written in reverse bit order
+	compatibility := uint32(data[2])<<24 | uint32(data[3])<<16 | uint32(data[4])<<8 | uint32(data[5])
+	var reversed uint32
+	for i := 0; i < 32; i++ {
+		reversed = reversed<<1 | compatibility&1
+		compatibility >>= 1
+	}
+
+	codec := fmt.Sprintf("%s.%s%d.%X.%s%d", format, profileSpace, profile, reversed, tier, data[12])
+
+	constraints := data[6:12]
+	last := len(constraints)
+	for last > 0 && constraints[last-1] == 0 {
+		last--
+	}
+	for _, c := range constraints[:last] {
+		codec += fmt.Sprintf(".%X", c)
+	}
+
+	return codec, true
+}
+
+// mp4aCodecString reads the object type and the audio object type from the
+// descriptors of esds, e.g. "mp4a.40.2" for AAC-LC.
+func mp4aCodecString(data []byte) (string, bool) {
+	r := newFieldReader(data)
+	r.fullBox()
+
+	objectType := -1
+	audioObjectType := -1
+	for r.err == nil && r.remaining() > 0 {
+		tag := r.uint8()
+		size := 0
+		for i := 0; i < 4; i++ {
+			b := r.uint8()
+			size = size<<7 | int(b&0x7f)
+			if b&0x80 == 0 {
+				break
+			}
+		}
+
+		switch tag {
+		case 0x03: // ES_Descriptor
+			r.skip(2) // ES_ID
+			flags := r.uint8()
+			if flags&0x80 != 0 {
+				r.skip(2) // dependsOn_ES_ID
+			}
+			if flags&0x40 != 0 {
+				r.skip(int(r.uint8())) // URLstring
+			}
+			if flags&0x20 != 0 {
+				r.skip(2) // OCR_ES_Id
+			}
+		case 0x04: // DecoderConfigDescriptor
+			objectType = int(r.uint8())
+			r.skip(1 + 3 + 4 + 4) // streamType, bufferSizeDB, maxBitrate, avgBitrate
+		case 0x05: // DecoderSpecificInfo
+			config := r.bytes(size)
+			if len(config) > 0 {
+				audioObjectType = int(config[0] >> 3)
+				if audioObjectType == 31 && len(config) > 1 {
+					audioObjectType = 32 + int(config[0]&0x07)<<3 | int(config[1]>>5)
+				}
+			}
+		default:
+			r.skip(size)
+		}
+	}
+
+	if objectType < 0 {
+		return "", false
+	}
+
+	if audioObjectType < 0 {
+		return fmt.Sprintf("mp4a.%x", objectType), true
+	}
+
+	return fmt.Sprintf("mp4a.%x.%d", objectType, audioObjectType), true
+}
+
+func ParseTrex(b *Box) (*Trex, error) {
+	if err := checkType(b, "trex"); err != nil {
+		return nil, err
+	}
+
+	r := newFieldReader(b.Data)
+	r.fullBox()
+	trex := &Trex{
+		TrackId:                       r.uint32(),
+		DefaultSampleDescriptionIndex: r.uint32(),
+		DefaultSampleDuration:         r.uint32(),
+		DefaultSampleSize:             r.uint32(),
+		DefaultSampleFlags:            r.uint32(),
+	}
+
+	return trex, r.err
+}
+
+func ParseSidx(b *Box) (*Sidx, error) {
+	if err := checkType(b, "sidx"); err != nil {
+		return nil, err
+	}
+
+	r := newFieldReader(b.Data)
+	version, _ := r.fullBox()
+	sidx := &Sidx{
+		ReferenceId:              r.uint32(),
+		Timescale:                r.uint32(),
+		EarliestPresentationTime: r.uint(version == 1),
+		FirstOffset:              r.uint(version == 1),
+	}
+	r.skip(2) // reserved
+	count := int(r.uint16())
+	if r.err != nil || r.remaining() < count*12 {
+		return nil, ErrShortBox
+	}
+
+	sidx.References = make([]SidxReference, count)
+	for i := range sidx.References {
+		size := r.uint32()
+		duration := r.uint32()
+		sap := r.uint32()
+		sidx.References[i] = SidxReference{
+			ReferenceType:      uint8(size >> 31),
+			ReferencedSize:     size & 0x7fffffff,
+			SubsegmentDuration: duration,
+			StartsWithSap:      sap>>31 == 1,
+			SapType:            uint8(sap >> 28 & 0x07),
+			SapDeltaTime:       sap & 0x0fffffff,
+		}
+	}
+
+	return sidx, r.err
+}
+
+func ParseMfhd(b *Box) (*Mfhd, error) {
+	if err := checkType(b, "mfhd"); err != nil {
+		return nil, err
+	}
+
+	r := newFieldReader(b.Data)
+	r.fullBox()
+	mfhd := &Mfhd{SequenceNumber: r.uint32()}
+
+	return mfhd, r.err
+}
+
+func ParseTfhd(b *Box) (*Tfhd, error) {
+	if err := checkType(b, "tfhd"); err != nil {
+		return nil, err
+	}
+
+	r := newFieldReader(b.Data)
+	_, flags := r.fullBox()
+	tfhd := &Tfhd{Flags: flags, TrackId: r.uint32()}
+	if flags&TfhdBaseDataOffsetPresent != 0 {
+		tfhd.BaseDataOffset = r.uint64()
+	}
+	if flags&TfhdSampleDescriptionIndexPresent != 0 {
+		tfhd.SampleDescriptionIndex = r.uint32()
+	}
+	if flags&TfhdDefaultSampleDurationPresent != 0 {
+		tfhd.DefaultSampleDuration = r.uint32()
+	}
+	if flags&TfhdDefaultSampleSizePresent != 0 {
+		tfhd.DefaultSampleSize = r.uint32()
+	}
+	if flags&TfhdDefaultSampleFlagsPresent != 0 {
+		tfhd.DefaultSampleFlags = r.uint32()
+	}
+
+	return tfhd, r.err
+}
+
+func ParseTfdt(b *Box) (*Tfdt, error) {
+	if err := checkType(b, "tfdt"); err != nil {
+		return nil, err
+	}
+
+	r := newFieldReader(b.Data)
+	version, _ := r.fullBox()
+	tfdt := &Tfdt{BaseMediaDecodeTime: r.uint(version == 1)}
+
+	return tfdt, r.err
+}
+
+func ParseTrun(b *Box) (*Trun, error) {
+	if err := checkType(b, "trun"); err != nil {
+		return nil, err
+	}
+
+	r := newFieldReader(b.Data)
+	version, flags := r.fullBox()
+	count := uint64(r.uint32())
+	trun := &Trun{Flags: flags}
+	if flags&TrunDataOffsetPresent != 0 {
+		trun.DataOffset = int32(r.uint32())
+	}
+	if flags&TrunFirstSampleFlagsPresent != 0 {
+		trun.FirstSampleFlags = r.uint32()
+	}
+
+	sampleSize := 0
+	for _, f := range []uint32{TrunSampleDurationPresent, TrunSampleSizePresent, TrunSampleFlagsPresent, TrunSampleCompositionTimeOffsetPresent} {
+		if flags&f != 0 {
+			sampleSize += 4
+		}
+	}
+	if r.err != nil || uint64(r.remaining()) < count*uint64(sampleSize) {
+		return nil, ErrShortBox
+	}
+	if count > MaxTrunSamples {
+		return nil, fmt.Errorf("mp4: 'trun' box has too many samples (%d)", count)
+	}
+
+	trun.Samples = make([]TrunSample, count)
+	for i := range trun.Samples {
+		s := &trun.Samples[i]
+		if flags&TrunSampleDurationPresent != 0 {
+			s.Duration = r.uint32()
+		}
+		if flags&TrunSampleSizePresent != 0 {
+			s.Size = r.uint32()
+		}
+		if flags&TrunSampleFlagsPresent != 0 {
+			s.Flags = r.uint32()
+		}
+		if flags&TrunSampleCompositionTimeOffsetPresent != 0 {
+			if version == 0 {
+				s.CompositionTimeOffset = int64(r.uint32())
+			} else {
+				s.CompositionTimeOffset = int64(int32(r.uint32()))
+			}
+		}
+	}
+
+	return trun, r.err
+}
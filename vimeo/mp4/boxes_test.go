@@ -0,0 +1,204 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mp4
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func encodeBox(b *Box) []byte {
+	buf := new(bytes.Buffer)
+	b.WriteTo(buf)
+
+	return buf.Bytes()
+}
+
+func newVisualSampleEntry(format string, width uint16, height uint16, children ...*Box) *Box {
+	data := encodeFields(make([]byte, 6), uint16(1), make([]byte, 16), width, height, make([]byte, 50))
+	for _, c := range children {
+		data = append(data, encodeBox(c)...)
+	}
+
+	return &Box{Type: format, Data: data}
+}
+
+func newAudioSampleEntry(format string, channels uint16, sampleRate uint32, children ...*Box) *Box {
+	data := encodeFields(make([]byte, 6), uint16(1), make([]byte, 8), channels, uint16(16), uint32(0), sampleRate<<16)
+	for _, c := range children {
+		data = append(data, encodeBox(c)...)
+	}
+
+	return &Box{Type: format, Data: data}
+}
+
+func TestParseFtyp(t *testing.T) {
+	box := &Box{Type: "ftyp", Data: []byte("iso6\x00\x00\x02\x00iso6dashmsdh")}
+	expected := &Ftyp{MajorBrand: "iso6", MinorVersion: 512, CompatibleBrands: []string{"iso6", "dash", "msdh"}}
+
+	actual, err := ParseFtyp(box)
+	if err != nil {
+		t.Errorf("ParseFtyp failed: %v", err)
+		return
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("ParseFtyp does not match.\nexpected: %v\nactual:   %v", expected, actual)
+		return
+	}
+}
+
+func TestParseMdhd(t *testing.T) {
+	// language "und"
+	box := &Box{Type: "mdhd", Data: fullBoxData(1, 0, uint64(0), uint64(0), uint32(90000), uint64(900000), uint16(0x55c4), uint16(0))}
+	expected := &Mdhd{Timescale: 90000, Duration: 900000, Language: "und"}
+
+	actual, err := ParseMdhd(box)
+	if err != nil {
+		t.Errorf("ParseMdhd failed: %v", err)
+		return
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("ParseMdhd does not match.\nexpected: %v\nactual:   %v", expected, actual)
+		return
+	}
+}
+
+func TestParseStsd(t *testing.T) {
+	avcC := &Box{Type: "avcC", Data: []byte{1, 0x64, 0x00, 0x1f, 0xff}}
+	esds := &Box{Type: "esds", Data: fullBoxData(0, 0,
+		[]byte{0x03, 0x19, 0x00, 0x01, 0x00},
+		[]byte{0x04, 0x11, 0x40, 0x15, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		[]byte{0x05, 0x02, 0x11, 0x90},
+		[]byte{0x06, 0x01, 0x02},
+	)}
+
+	cases := []struct {
+		handlerType string
+		entry       *Box
+		expected    *SampleEntry
+	}{
+		{
+			"vide",
+			newVisualSampleEntry("avc1", 1920, 1080, avcC),
+			&SampleEntry{Format: "avc1", Codec: "avc1.64001f", Width: 1920, Height: 1080},
+		},
+		{
+			"soun",
+			newAudioSampleEntry("mp4a", 2, 48000, esds),
+			&SampleEntry{Format: "mp4a", Codec: "mp4a.40.2", ChannelCount: 2, SampleSize: 16, SampleRate: 48000},
+		},
+		{
+			"vide",
+			newVisualSampleEntry("encv", 1280, 720, avcC, &Box{Type: "sinf", Children: []*Box{{Type: "frma", Data: []byte("avc1")}}}),
+			&SampleEntry{Format: "encv", Codec: "avc1.64001f", Width: 1280, Height: 720},
+		},
+	}
+
+	for _, c := range cases {
+		stsd := &Box{Type: "stsd", Data: append(fullBoxData(0, 0, uint32(1)), encodeBox(c.entry)...)}
+		actual, err := ParseStsd(stsd, c.handlerType)
+		if err != nil {
+			t.Errorf("ParseStsd failed: %v", err)
+			continue
+		}
+
+		if len(actual) != 1 || !reflect.DeepEqual(c.expected, actual[0]) {
+			t.Errorf("ParseStsd does not match.\nexpected: %v\nactual:   %v", c.expected, actual)
+		}
+	}
+}
+
+func TestHevcCodecString(t *testing.T) {
+	data := []byte{1, 0x01, 0x60, 0, 0, 0, 0x90, 0, 0, 0, 0, 0, 93}
+
+	actual, ok := hevcCodecString("hvc1", data)
+	if !ok || actual != "hvc1.1.6.L93.90" {
+		t.Errorf("hevcCodecString does not match.\nexpected: %v\nactual:   %v", "hvc1.1.6.L93.90", actual)
+	}
+}
+
+func TestParseSidx(t *testing.T) {
+	box := &Box{Type: "sidx", Data: fullBoxData(0, 0, uint32(1), uint32(90000), uint32(180000), uint32(0), uint16(0), uint16(2),
+		uint32(1000), uint32(180000), uint32(0x90000000),
+		uint32(2000), uint32(180000), uint32(0x90000000),
+	)}
+	expected := &Sidx{
+		ReferenceId:              1,
+		Timescale:                90000,
+		EarliestPresentationTime: 180000,
+		References: []SidxReference{
+			{ReferencedSize: 1000, SubsegmentDuration: 180000, StartsWithSap: true, SapType: 1},
+			{ReferencedSize: 2000, SubsegmentDuration: 180000, StartsWithSap: true, SapType: 1},
+		},
+	}
+
+	actual, err := ParseSidx(box)
+	if err != nil {
+		t.Errorf("ParseSidx failed: %v", err)
+		return
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("ParseSidx does not match.\nexpected: %v\nactual:   %v", expected, actual)
+		return
+	}
+}
+
+func TestParseTfhdAndTrun(t *testing.T) {
+	tfhdBox := &Box{Type: "tfhd", Data: fullBoxData(0, TfhdDefaultSampleDurationPresent|TfhdDefaultBaseIsMoof, uint32(2), uint32(1024))}
+	expectedTfhd := &Tfhd{Flags: TfhdDefaultSampleDurationPresent | TfhdDefaultBaseIsMoof, TrackId: 2, DefaultSampleDuration: 1024}
+
+	tfhd, err := ParseTfhd(tfhdBox)
+	if err != nil || !reflect.DeepEqual(expectedTfhd, tfhd) {
+		t.Errorf("ParseTfhd does not match (%v).\nexpected: %v\nactual:   %v", err, expectedTfhd, tfhd)
+	}
+
+	flags := uint32(TrunDataOffsetPresent | TrunSampleSizePresent | TrunSampleCompositionTimeOffsetPresent)
+	trunBox := &Box{Type: "trun", Data: fullBoxData(1, flags, uint32(2), int32(120), uint32(300), int32(-10), uint32(400), int32(20))}
+	expectedTrun := &Trun{
+		Flags:      flags,
+		DataOffset: 120,
+		Samples: []TrunSample{
+			{Size: 300, CompositionTimeOffset: -10},
+			{Size: 400, CompositionTimeOffset: 20},
+		},
+	}
+
+	trun, err := ParseTrun(trunBox)
+	if err != nil || !reflect.DeepEqual(expectedTrun, trun) {
+		t.Errorf("ParseTrun does not match (%v).\nexpected: %v\nactual:   %v", err, expectedTrun, trun)
+	}
+}
+
+func TestParseTrunWithShortData(t *testing.T) {
+	box := &Box{Type: "trun", Data: fullBoxData(0, TrunSampleSizePresent, uint32(100), uint32(1))}
+
+	_, err := ParseTrun(box)
+	if err == nil {
+		t.Errorf("ParseTrun must fail when samples exceed data")
+	}
+}
+
+func TestParseTrunWithTooManySamples(t *testing.T) {
+	box := &Box{Type: "trun", Data: fullBoxData(0, 0, uint32(0xffffffff))}
+
+	_, err := ParseTrun(box)
+	if err == nil {
+		t.Errorf("ParseTrun must fail when the sample count exceeds MaxTrunSamples")
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mp4
+
+import (
+	"encoding/binary"
+)
+
+// Helpers for reading and patching fields of full boxes in place.
+
+func (b *Box) Version() uint8 {
+	if len(b.Data) < 1 {
+		return 0
+	}
+
+	return b.Data[0]
+}
+
+func (b *Box) Flags() uint32 {
+	if len(b.Data) < 4 {
+		return 0
+	}
+
+	return binary.BigEndian.Uint32(b.Data[0:4]) & 0x00ffffff
+}
+
+func (b *Box) uint32At(offset int) (uint32, error) {
+	if offset < 0 || len(b.Data) < offset+4 {
+		return 0, ErrShortBox
+	}
+
+	return binary.BigEndian.Uint32(b.Data[offset:]), nil
+}
+
+func (b *Box) uint64At(offset int) (uint64, error) {
+	if offset < 0 || len(b.Data) < offset+8 {
+		return 0, ErrShortBox
+	}
+
+	return binary.BigEndian.Uint64(b.Data[offset:]), nil
+}
+
+func (b *Box) putUint32At(offset int, v uint32) error {
+	if offset < 0 || len(b.Data) < offset+4 {
+		return ErrShortBox
+	}
+
+	binary.BigEndian.PutUint32(b.Data[offset:], v)
+	return nil
+}
+
+func (b *Box) putUint64At(offset int, v uint64) error {
+	if offset < 0 || len(b.Data) < offset+8 {
+		return ErrShortBox
+	}
+
+	binary.BigEndian.PutUint64(b.Data[offset:], v)
+	return nil
+}
+
+// uintAt reads a field which is 64-bit in version 1 boxes and 32-bit otherwise.
+func (b *Box) uintAt(offset int, wide bool) (uint64, error) {
+	if wide {
+		return b.uint64At(offset)
+	}
+
+	v, err := b.uint32At(offset)
+	return uint64(v), err
+}
+
+func (b *Box) putUintAt(offset int, wide bool, v uint64) error {
+	if wide {
+		return b.putUint64At(offset, v)
+	}
+
+	if v > 0xffffffff {
+		v = 0xffffffff
+	}
+
+	return b.putUint32At(offset, uint32(v))
+}
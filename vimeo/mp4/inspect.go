@@ -0,0 +1,304 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mp4
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// Track describes a trak of the moov box.
+type Track struct {
+	Id          uint32
+	HandlerType string
+	Timescale   uint32
+	Duration    uint64
+	Language    string
+	SampleEntry
+	Trex *Trex
+}
+
+// TrackFragment summarizes a traf box of a moof.
+type TrackFragment struct {
+	TrackId             uint32
+	BaseMediaDecodeTime uint64
+	Duration            uint64
+	SampleCount         int
+}
+
+// Fragment summarizes a moof box and the mdat boxes following it.
+type Fragment struct {
+	SequenceNumber uint32
+	Offset         int64
+	Tracks         []TrackFragment
+	DataSize       int64
+}
+
+// Info is what Inspect found in an mp4 file.
+type Info struct {
+	Ftyp      *Ftyp
+	Movie     *Mvhd
+	Tracks    []*Track
+	Indexes   []*Sidx
+	Fragments []*Fragment
+}
+
+// Inspect reads an mp4 file (or an init segment, or media segments) from r
+// and parses its structure. The payload of mdat is skipped.
+func Inspect(r io.Reader) (*Info, error) {
+	cr := &countingReader{r: bufio.NewReader(r)}
+	info := &Info{
+		Tracks:    []*Track{},
+		Indexes:   []*Sidx{},
+		Fragments: []*Fragment{},
+	}
+
+	var fragment *Fragment
+	for {
+		offset := cr.n
+		header, err := ReadHeader(cr)
+		if err == io.EOF {
+			return info, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch header.Type {
+		case "mdat", "free", "skip":
+			if header.Type == "mdat" && fragment != nil {
+				fragment.DataSize += header.PayloadSize()
+			}
+
+			if header.Size == 0 {
+				_, err = io.Copy(io.Discard, cr)
+			} else {
+				_, err = io.CopyN(io.Discard, cr, header.PayloadSize())
+			}
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		box, err := ReadBoxPayload(cr, header)
+		if err != nil {
+			return nil, err
+		}
+
+		switch box.Type {
+		case "ftyp":
+			info.Ftyp, err = ParseFtyp(box)
+		case "moov":
+			err = info.parseMoov(box)
+		case "sidx":
+			var sidx *Sidx
+			sidx, err = ParseSidx(box)
+			if err == nil {
+				info.Indexes = append(info.Indexes, sidx)
+			}
+		case "moof":
+			fragment, err = info.parseMoof(box)
+			if err == nil {
+				fragment.Offset = offset
+				info.Fragments = append(info.Fragments, fragment)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func InspectBytes(data []byte) (*Info, error) {
+	return Inspect(bytes.NewReader(data))
+}
+
+// Track returns the track with the given id, or nil.
+func (info *Info) Track(id uint32) *Track {
+	for _, t := range info.Tracks {
+		if t.Id == id {
+			return t
+		}
+	}
+
+	return nil
+}
+
+// TrackDuration returns the duration of a track in seconds. Fragments are
+// summed when present, since fragmented files usually have no duration in
+// the moov box.
+func (info *Info) TrackDuration(id uint32) float64 {
+	track := info.Track(id)
+	if track == nil || track.Timescale == 0 {
+		return 0
+	}
+
+	duration := track.Duration
+	if len(info.Fragments) > 0 {
+		duration = 0
+		for _, f := range info.Fragments {
+			for _, t := range f.Tracks {
+				if t.TrackId == id {
+					duration += t.Duration
+				}
+			}
+		}
+	}
+
+	return float64(duration) / float64(track.Timescale)
+}
+
+func (info *Info) parseMoov(moov *Box) error {
+	var err error
+	if mvhd := moov.Child("mvhd"); mvhd != nil {
+		info.Movie, err = ParseMvhd(mvhd)
+		if err != nil {
+			return err
+		}
+	}
+
+	trexs := map[uint32]*Trex{}
+	if mvex := moov.Child("mvex"); mvex != nil {
+		for _, box := range mvex.ChildrenOf("trex") {
+			trex, err := ParseTrex(box)
+			if err != nil {
+				return err
+			}
+			trexs[trex.TrackId] = trex
+		}
+	}
+
+	for _, trak := range moov.ChildrenOf("trak") {
+		track, err := parseTrak(trak)
+		if err != nil {
+			return err
+		}
+
+		track.Trex = trexs[track.Id]
+		info.Tracks = append(info.Tracks, track)
+	}
+
+	return nil
+}
+
+func parseTrak(trak *Box) (*Track, error) {
+	tkhdBox := trak.Child("tkhd")
+	mdhdBox := trak.Find("mdia", "mdhd")
+	if tkhdBox == nil || mdhdBox == nil {
+		return nil, errors.New("mp4: trak box has no tkhd or mdhd")
+	}
+
+	tkhd, err := ParseTkhd(tkhdBox)
+	if err != nil {
+		return nil, err
+	}
+
+	mdhd, err := ParseMdhd(mdhdBox)
+	if err != nil {
+		return nil, err
+	}
+
+	track := &Track{
+		Id:        tkhd.TrackId,
+		Timescale: mdhd.Timescale,
+		Duration:  mdhd.Duration,
+		Language:  mdhd.Language,
+	}
+
+	if hdlrBox := trak.Find("mdia", "hdlr"); hdlrBox != nil {
+		hdlr, err := ParseHdlr(hdlrBox)
+		if err != nil {
+			return nil, err
+		}
+		track.HandlerType = hdlr.HandlerType
+	}
+
+	if stsdBox := trak.Find("mdia", "minf", "stbl", "stsd"); stsdBox != nil {
+		entries, err := ParseStsd(stsdBox, track.HandlerType)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(entries) > 0 {
+			track.SampleEntry = *entries[0]
+		}
+	}
+
+	return track, nil
+}
+
+func (info *Info) parseMoof(moof *Box) (*Fragment, error) {
+	fragment := &Fragment{Tracks: []TrackFragment{}}
+
+	if mfhdBox := moof.Child("mfhd"); mfhdBox != nil {
+		mfhd, err := ParseMfhd(mfhdBox)
+		if err != nil {
+			return nil, err
+		}
+		fragment.SequenceNumber = mfhd.SequenceNumber
+	}
+
+	for _, traf := range moof.ChildrenOf("traf") {
+		tfhdBox := traf.Child("tfhd")
+		if tfhdBox == nil {
+			return nil, errors.New("mp4: traf box has no tfhd")
+		}
+
+		tfhd, err := ParseTfhd(tfhdBox)
+		if err != nil {
+			return nil, err
+		}
+
+		trackFragment := TrackFragment{TrackId: tfhd.TrackId}
+
+		if tfdtBox := traf.Child("tfdt"); tfdtBox != nil {
+			tfdt, err := ParseTfdt(tfdtBox)
+			if err != nil {
+				return nil, err
+			}
+			trackFragment.BaseMediaDecodeTime = tfdt.BaseMediaDecodeTime
+		}
+
+		defaultDuration := tfhd.DefaultSampleDuration
+		if tfhd.Flags&TfhdDefaultSampleDurationPresent == 0 {
+			if track := info.Track(tfhd.TrackId); track != nil && track.Trex != nil {
+				defaultDuration = track.Trex.DefaultSampleDuration
+			}
+		}
+
+		for _, trunBox := range traf.ChildrenOf("trun") {
+			trun, err := ParseTrun(trunBox)
+			if err != nil {
+				return nil, err
+			}
+
+			trackFragment.SampleCount += len(trun.Samples)
+			for _, s := range trun.Samples {
+				if trun.Flags&TrunSampleDurationPresent != 0 {
+					trackFragment.Duration += uint64(s.Duration)
+				} else {
+					trackFragment.Duration += uint64(defaultDuration)
+				}
+			}
+		}
+
+		fragment.Tracks = append(fragment.Tracks, trackFragment)
+	}
+
+	return fragment, nil
+}
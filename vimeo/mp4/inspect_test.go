@@ -0,0 +1,102 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mp4
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	buf := new(bytes.Buffer)
+	(&Box{Type: "ftyp", Data: []byte("iso6\x00\x00\x00\x00iso6dash")}).WriteTo(buf)
+	(&Box{Type: "moov", Children: []*Box{
+		{Type: "mvhd", Data: fullBoxData(0, 0, uint32(0), uint32(0), uint32(1000), uint32(0), make([]byte, 76), uint32(2))},
+		{Type: "trak", Children: []*Box{
+			{Type: "tkhd", Data: fullBoxData(0, 3, uint32(0), uint32(0), uint32(1), uint32(0), uint32(0), make([]byte, 52), uint32(1920<<16), uint32(1080<<16))},
+			{Type: "mdia", Children: []*Box{
+				{Type: "mdhd", Data: fullBoxData(0, 0, uint32(0), uint32(0), uint32(90000), uint32(0), uint16(0x55c4), uint16(0))},
+				{Type: "hdlr", Data: fullBoxData(0, 0, uint32(0), []byte("vide"), make([]byte, 12), []byte("VideoHandler\x00"))},
+				{Type: "minf", Children: []*Box{
+					{Type: "stbl", Children: []*Box{
+						{Type: "stsd", Data: append(fullBoxData(0, 0, uint32(1)), encodeBox(newVisualSampleEntry("avc1", 1920, 1080, &Box{Type: "avcC", Data: []byte{1, 0x4d, 0x40, 0x28}}))...)},
+					}},
+				}},
+			}},
+		}},
+		{Type: "mvex", Children: []*Box{
+			{Type: "trex", Data: fullBoxData(0, 0, uint32(1), uint32(1), uint32(3000), uint32(0), uint32(0))},
+		}},
+	}}).WriteTo(buf)
+
+	for i := 0; i < 2; i++ {
+		(&Box{Type: "sidx", Data: fullBoxData(1, 0, uint32(1), uint32(90000), uint64(i*180000), uint64(0), uint16(0), uint16(1), uint32(100), uint32(180000), uint32(0x90000000))}).WriteTo(buf)
+		(&Box{Type: "moof", Children: []*Box{
+			{Type: "mfhd", Data: fullBoxData(0, 0, uint32(i+10))},
+			{Type: "traf", Children: []*Box{
+				{Type: "tfhd", Data: fullBoxData(0, TfhdDefaultBaseIsMoof, uint32(1))},
+				{Type: "tfdt", Data: fullBoxData(1, 0, uint64(i*180000))},
+				{Type: "trun", Data: fullBoxData(0, TrunSampleSizePresent, uint32(60), make([]byte, 60*4))},
+			}},
+		}}).WriteTo(buf)
+		(&Box{Type: "mdat", Data: make([]byte, 1000)}).WriteTo(buf)
+	}
+
+	info, err := Inspect(buf)
+	if err != nil {
+		t.Errorf("Inspect failed: %v", err)
+		return
+	}
+
+	if info.Ftyp.MajorBrand != "iso6" || info.Movie.Timescale != 1000 {
+		t.Errorf("Inspect ftyp or mvhd does not match: %v %v", info.Ftyp, info.Movie)
+	}
+
+	expectedTrack := &Track{
+		Id:          1,
+		HandlerType: "vide",
+		Timescale:   90000,
+		Language:    "und",
+		SampleEntry: SampleEntry{Format: "avc1", Codec: "avc1.4d4028", Width: 1920, Height: 1080},
+		Trex:        &Trex{TrackId: 1, DefaultSampleDescriptionIndex: 1, DefaultSampleDuration: 3000},
+	}
+	if len(info.Tracks) != 1 || !reflect.DeepEqual(expectedTrack, info.Tracks[0]) {
+		t.Errorf("Inspect tracks do not match.\nexpected: %v\nactual:   %v", expectedTrack, info.Tracks)
+	}
+
+	if len(info.Indexes) != 2 {
+		t.Errorf("Inspect must find 2 sidx boxes: %v", len(info.Indexes))
+	}
+
+	if len(info.Fragments) != 2 {
+		t.Errorf("Inspect must find 2 fragments: %v", len(info.Fragments))
+		return
+	}
+
+	expectedFragment := &Fragment{
+		SequenceNumber: 11,
+		Offset:         info.Fragments[1].Offset,
+		Tracks:         []TrackFragment{{TrackId: 1, BaseMediaDecodeTime: 180000, Duration: 180000, SampleCount: 60}},
+		DataSize:       1000,
+	}
+	if !reflect.DeepEqual(expectedFragment, info.Fragments[1]) {
+		t.Errorf("Inspect fragment does not match.\nexpected: %v\nactual:   %v", expectedFragment, info.Fragments[1])
+	}
+
+	if duration := info.TrackDuration(1); duration != 4 {
+		t.Errorf("TrackDuration does not match.\nexpected: %v\nactual:   %v", 4, duration)
+	}
+}
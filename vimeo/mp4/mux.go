@@ -0,0 +1,581 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mp4
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+)
+
+// fragmentBoundaries are the top-level boxes which end the boxes belonging
+// to the preceding moof. They are dropped from the output, since indexes
+// such as sidx are no longer valid after muxing.
+var fragmentBoundaries = map[string]bool{
+	"moof": true,
+	"styp": true,
+	"sidx": true,
+	"ssix": true,
+	"prft": true,
+	"emsg": true,
+	"ftyp": true,
+	"moov": true,
+	"mfra": true,
+}
+
+// Mux combines fragmented MP4 files, each being an init segment (ftyp and
+// moov) followed by moof/mdat fragments, into a single fragmented MP4 which
+// contains the tracks of every input. Fragments are interleaved by their
+// decode time. The ftyp and movie header of the first input are used.
+func Mux(output io.Writer, inputs ...io.Reader) error {
+	if len(inputs) == 0 {
+		return errors.New("mp4: no inputs to mux")
+	}
+
+	nextTrackId := uint32(1)
+	srcs := make([]*muxInput, len(inputs))
+	for i, r := range inputs {
+		src, err := newMuxInput(r, &nextTrackId)
+		if err != nil {
+			return err
+		}
+		srcs[i] = src
+	}
+
+	moov, err := mergeMoov(srcs, nextTrackId)
+	if err != nil {
+		return err
+	}
+
+	w := &countingWriter{w: output}
+	if srcs[0].ftyp != nil {
+		_, err = srcs[0].ftyp.WriteTo(w)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = moov.WriteTo(w)
+	if err != nil {
+		return err
+	}
+
+	for _, src := range srcs {
+		err = src.nextFragment()
+		if err != nil {
+			return err
+		}
+	}
+
+	sequenceNumber := uint32(0)
+	for {
+		var src *muxInput
+		for _, s := range srcs {
+			if s.moof != nil && (src == nil || s.time < src.time) {
+				src = s
+			}
+		}
+		if src == nil {
+			break
+		}
+
+		sequenceNumber++
+		err = src.writeFragment(w, sequenceNumber)
+		if err != nil {
+			return err
+		}
+
+		err = src.nextFragment()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type muxInput struct {
+	r *countingReader
+
+	ftyp           *Box
+	moov           *Box
+	movieTimescale uint32
+	trackIds       map[uint32]uint32
+	timescales     map[uint32]uint32
+
+	// top-level box header which has been read but not consumed yet
+	header       *Header
+	headerOffset int64
+
+	moof       *Box
+	moofOffset int64
+	time       float64
+}
+
+func newMuxInput(r io.Reader, nextTrackId *uint32) (*muxInput, error) {
+	src := &muxInput{
+		r:          &countingReader{r: bufio.NewReader(r)},
+		trackIds:   map[uint32]uint32{},
+		timescales: map[uint32]uint32{},
+	}
+
+	for src.moov == nil {
+		header, _, err := src.readHeader()
+		if err == io.EOF {
+			return nil, errors.New("mp4: moov box is not found")
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch header.Type {
+		case "ftyp":
+			src.ftyp, err = ReadBoxPayload(src.r, header)
+		case "moov":
+			src.moov, err = ReadBoxPayload(src.r, header)
+		default:
+			err = src.skip(header)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	mvhd := src.moov.Child("mvhd")
+	if mvhd == nil {
+		return nil, errors.New("mp4: mvhd box is not found")
+	}
+
+	timescale, err := mvhd.uint32At(timescaleOffset(mvhd))
+	if err != nil {
+		return nil, err
+	}
+	src.movieTimescale = timescale
+
+	for _, trak := range src.moov.ChildrenOf("trak") {
+		tkhd := trak.Child("tkhd")
+		mdhd := trak.Find("mdia", "mdhd")
+		if tkhd == nil || mdhd == nil {
+			return nil, errors.New("mp4: trak box has no tkhd or mdhd")
+		}
+
+		trackId, err := tkhd.uint32At(tkhdTrackIdOffset(tkhd))
+		if err != nil {
+			return nil, err
+		}
+
+		timescale, err := mdhd.uint32At(timescaleOffset(mdhd))
+		if err != nil {
+			return nil, err
+		}
+
+		src.trackIds[trackId] = *nextTrackId
+		src.timescales[trackId] = timescale
+		*nextTrackId++
+	}
+
+	return src, nil
+}
+
+func (src *muxInput) readHeader() (*Header, int64, error) {
+	if src.header != nil {
+		header := src.header
+		src.header = nil
+		return header, src.headerOffset, nil
+	}
+
+	offset := src.r.n
+	header, err := ReadHeader(src.r)
+	return header, offset, err
+}
+
+func (src *muxInput) skip(header *Header) error {
+	if header.Size == 0 {
+		_, err := io.Copy(io.Discard, src.r)
+		return err
+	}
+
+	_, err := io.CopyN(io.Discard, src.r, header.PayloadSize())
+	return err
+}
+
+// nextFragment reads the next moof box, skipping any other top-level box
+// in front of it. src.moof is nil at the end of the input.
+func (src *muxInput) nextFragment() error {
+	src.moof = nil
+
+	for {
+		header, offset, err := src.readHeader()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if header.Type != "moof" {
+			err = src.skip(header)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		src.moof, err = ReadBoxPayload(src.r, header)
+		if err != nil {
+			return err
+		}
+		src.moofOffset = offset
+
+		traf := src.moof.Child("traf")
+		if traf == nil {
+			return nil
+		}
+
+		tfhd := traf.Child("tfhd")
+		tfdt := traf.Child("tfdt")
+		if tfhd == nil || tfdt == nil {
+			return nil
+		}
+
+		trackId, err := tfhd.uint32At(4)
+		if err != nil {
+			return err
+		}
+
+		baseMediaDecodeTime, err := tfdt.uintAt(4, tfdt.Version() == 1)
+		if err != nil {
+			return err
+		}
+
+		if timescale := src.timescales[trackId]; timescale > 0 {
+			src.time = float64(baseMediaDecodeTime) / float64(timescale)
+		}
+
+		return nil
+	}
+}
+
+// writeFragment writes the current moof with renumbered tracks and sequence
+// number, followed by the boxes (usually mdat) up to the next fragment.
+func (src *muxInput) writeFragment(w *countingWriter, sequenceNumber uint32) error {
+	mfhd := src.moof.Child("mfhd")
+	if mfhd != nil {
+		err := mfhd.putUint32At(4, sequenceNumber)
+		if err != nil {
+			return err
+		}
+	}
+
+	delta := w.n - src.moofOffset
+	for _, traf := range src.moof.ChildrenOf("traf") {
+		tfhd := traf.Child("tfhd")
+		if tfhd == nil {
+			return errors.New("mp4: traf box has no tfhd")
+		}
+
+		trackId, err := tfhd.uint32At(4)
+		if err != nil {
+			return err
+		}
+
+		newTrackId, ok := src.trackIds[trackId]
+		if !ok {
+			return fmt.Errorf("mp4: fragment refers to unknown track %d", trackId)
+		}
+
+		err = tfhd.putUint32At(4, newTrackId)
+		if err != nil {
+			return err
+		}
+
+		if tfhd.Flags()&TfhdBaseDataOffsetPresent != 0 {
+			baseDataOffset, err := tfhd.uint64At(8)
+			if err != nil {
+				return err
+			}
+
+			err = tfhd.putUint64At(8, uint64(int64(baseDataOffset)+delta))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := src.moof.WriteTo(w)
+	if err != nil {
+		return err
+	}
+
+	for {
+		header, offset, err := src.readHeader()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if fragmentBoundaries[header.Type] {
+			src.header = header
+			src.headerOffset = offset
+			return nil
+		}
+
+		if header.Size == 0 {
+			return fmt.Errorf("mp4: '%s' box without size is not supported", header.Type)
+		}
+
+		_, err = WriteHeader(w, header.Type, header.Size, header.HeaderSize == 16)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.CopyN(w, src.r, header.PayloadSize())
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// mergeMoov builds a moov box with the tracks of every input, whose durations
+// are converted to the movie timescale of the first input.
+func mergeMoov(srcs []*muxInput, nextTrackId uint32) (*Box, error) {
+	mvhd := srcs[0].moov.Child("mvhd")
+	timescale := srcs[0].movieTimescale
+
+	traks := []*Box{}
+	trexs := []*Box{}
+	var mehd *Box
+	var duration, fragmentDuration uint64
+	for _, src := range srcs {
+		srcMvhd := src.moov.Child("mvhd")
+		d, err := srcMvhd.uintAt(durationOffset(srcMvhd), srcMvhd.Version() == 1)
+		if err != nil {
+			return nil, err
+		}
+		duration = maxUint64(duration, rescale(d, src.movieTimescale, timescale))
+
+		for _, trak := range src.moov.ChildrenOf("trak") {
+			err = renumberTrak(trak, src, timescale)
+			if err != nil {
+				return nil, err
+			}
+			traks = append(traks, trak)
+		}
+
+		mvex := src.moov.Child("mvex")
+		if mvex == nil {
+			continue
+		}
+
+		if srcMehd := mvex.Child("mehd"); srcMehd != nil {
+			d, err := srcMehd.uintAt(4, srcMehd.Version() == 1)
+			if err != nil {
+				return nil, err
+			}
+			fragmentDuration = maxUint64(fragmentDuration, rescale(d, src.movieTimescale, timescale))
+
+			if mehd == nil {
+				mehd = srcMehd
+			}
+		}
+
+		for _, trex := range mvex.ChildrenOf("trex") {
+			trackId, err := trex.uint32At(4)
+			if err != nil {
+				return nil, err
+			}
+
+			err = trex.putUint32At(4, src.trackIds[trackId])
+			if err != nil {
+				return nil, err
+			}
+			trexs = append(trexs, trex)
+		}
+	}
+
+	err := mvhd.putUintAt(durationOffset(mvhd), mvhd.Version() == 1, duration)
+	if err != nil {
+		return nil, err
+	}
+
+	err = mvhd.putUint32At(len(mvhd.Data)-4, nextTrackId)
+	if err != nil {
+		return nil, err
+	}
+
+	mvex := &Box{Type: "mvex", Children: trexs}
+	if mehd != nil {
+		err = mehd.putUintAt(4, mehd.Version() == 1, fragmentDuration)
+		if err != nil {
+			return nil, err
+		}
+		mvex.Children = append([]*Box{mehd}, trexs...)
+	}
+
+	moov := &Box{Type: "moov", Children: []*Box{mvhd}}
+	moov.Children = append(moov.Children, traks...)
+	moov.Children = append(moov.Children, mvex)
+	for _, c := range srcs[0].moov.Children {
+		if c.Type != "mvhd" && c.Type != "trak" && c.Type != "mvex" {
+			moov.Children = append(moov.Children, c)
+		}
+	}
+
+	return moov, nil
+}
+
+func renumberTrak(trak *Box, src *muxInput, timescale uint32) error {
+	tkhd := trak.Child("tkhd")
+	trackId, err := tkhd.uint32At(tkhdTrackIdOffset(tkhd))
+	if err != nil {
+		return err
+	}
+
+	err = tkhd.putUint32At(tkhdTrackIdOffset(tkhd), src.trackIds[trackId])
+	if err != nil {
+		return err
+	}
+
+	if src.movieTimescale == timescale {
+		return nil
+	}
+
+	wide := tkhd.Version() == 1
+	d, err := tkhd.uintAt(tkhdDurationOffset(tkhd), wide)
+	if err != nil {
+		return err
+	}
+	if (wide && d != math.MaxUint64) || (!wide && d != math.MaxUint32) {
+		err = tkhd.putUintAt(tkhdDurationOffset(tkhd), wide, rescale(d, src.movieTimescale, timescale))
+		if err != nil {
+			return err
+		}
+	}
+
+	elst := trak.Find("edts", "elst")
+	if elst == nil {
+		return nil
+	}
+
+	entryCount, err := elst.uint32At(4)
+	if err != nil {
+		return err
+	}
+
+	wide = elst.Version() == 1
+	entrySize := 12
+	if wide {
+		entrySize = 20
+	}
+
+	for i := 0; i < int(entryCount); i++ {
+		offset := 8 + i*entrySize
+		d, err := elst.uintAt(offset, wide)
+		if err != nil {
+			return err
+		}
+
+		err = elst.putUintAt(offset, wide, rescale(d, src.movieTimescale, timescale))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// timescaleOffset returns the offset of the timescale in mvhd and mdhd.
+func timescaleOffset(b *Box) int {
+	if b.Version() == 1 {
+		return 20
+	}
+
+	return 12
+}
+
+// durationOffset returns the offset of the duration in mvhd and mdhd.
+func durationOffset(b *Box) int {
+	if b.Version() == 1 {
+		return 24
+	}
+
+	return 16
+}
+
+func tkhdTrackIdOffset(tkhd *Box) int {
+	if tkhd.Version() == 1 {
+		return 20
+	}
+
+	return 12
+}
+
+func tkhdDurationOffset(tkhd *Box) int {
+	if tkhd.Version() == 1 {
+		return 28
+	}
+
+	return 20
+}
+
+// rescale converts v from one timescale to another without overflowing.
+func rescale(v uint64, from uint32, to uint32) uint64 {
+	if from == to || from == 0 {
+		return v
+	}
+
+	hi, lo := bits.Mul64(v, uint64(to))
+	if hi >= uint64(from) {
+		return math.MaxUint64
+	}
+
+	q, _ := bits.Div64(hi, lo, uint64(from))
+	return q
+}
+
+func maxUint64(a uint64, b uint64) uint64 {
+	if a > b {
+		return a
+	}
+
+	return b
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
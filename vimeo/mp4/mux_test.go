@@ -0,0 +1,203 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func encodeFields(fields ...interface{}) []byte {
+	buf := new(bytes.Buffer)
+	for _, f := range fields {
+		binary.Write(buf, binary.BigEndian, f)
+	}
+
+	return buf.Bytes()
+}
+
+func fullBoxData(version uint8, flags uint32, fields ...interface{}) []byte {
+	return encodeFields(append([]interface{}{uint32(version)<<24 | flags}, fields...)...)
+}
+
+// newTestFile builds a fragmented mp4 with a single track whose fragments
+// start at the given decode times.
+func newTestFile(trackId uint32, handler string, timescale uint32, times []uint64, payloads []string) []byte {
+	ftyp := &Box{Type: "ftyp", Data: []byte("iso6\x00\x00\x00\x00iso6dash")}
+	mvhd := &Box{Type: "mvhd", Data: fullBoxData(0, 0, uint32(0), uint32(0), uint32(1000), uint32(0), make([]byte, 76), trackId+1)}
+	tkhd := &Box{Type: "tkhd", Data: fullBoxData(0, 3, uint32(0), uint32(0), trackId, uint32(0), uint32(0), make([]byte, 60))}
+	mdhd := &Box{Type: "mdhd", Data: fullBoxData(0, 0, uint32(0), uint32(0), timescale, uint32(0), uint32(0x55c40000))}
+	hdlr := &Box{Type: "hdlr", Data: fullBoxData(0, 0, uint32(0), []byte(handler), make([]byte, 13))}
+	trak := &Box{Type: "trak", Children: []*Box{
+		tkhd,
+		{Type: "mdia", Children: []*Box{mdhd, hdlr}},
+	}}
+	trex := &Box{Type: "trex", Data: fullBoxData(0, 0, trackId, uint32(1), uint32(0), uint32(0), uint32(0))}
+	moov := &Box{Type: "moov", Children: []*Box{mvhd, trak, {Type: "mvex", Children: []*Box{trex}}}}
+
+	buf := new(bytes.Buffer)
+	ftyp.WriteTo(buf)
+	moov.WriteTo(buf)
+
+	for i, t := range times {
+		styp := &Box{Type: "styp", Data: []byte("msdh\x00\x00\x00\x00msdhmsix")}
+		sidx := &Box{Type: "sidx", Data: fullBoxData(1, 0, trackId, timescale, t, uint64(0), uint16(0), uint16(0))}
+		moof := &Box{Type: "moof", Children: []*Box{
+			{Type: "mfhd", Data: fullBoxData(0, 0, uint32(i+1))},
+			{Type: "traf", Children: []*Box{
+				{Type: "tfhd", Data: fullBoxData(0, 0x020000, trackId)},
+				{Type: "tfdt", Data: fullBoxData(1, 0, t)},
+			}},
+		}}
+		mdat := &Box{Type: "mdat", Data: []byte(payloads[i])}
+
+		styp.WriteTo(buf)
+		sidx.WriteTo(buf)
+		moof.WriteTo(buf)
+		mdat.WriteTo(buf)
+	}
+
+	return buf.Bytes()
+}
+
+func TestMux(t *testing.T) {
+	video := newTestFile(1, "vide", 90000, []uint64{0, 180000, 360000}, []string{"v0", "v1", "v2"})
+	audio := newTestFile(1, "soun", 48000, []uint64{0, 48000, 96000, 144000, 192000}, []string{"a0", "a1", "a2", "a3", "a4"})
+
+	output := new(bytes.Buffer)
+	err := Mux(output, bytes.NewReader(video), bytes.NewReader(audio))
+	if err != nil {
+		t.Errorf("Mux failed: %v", err)
+		return
+	}
+
+	boxes, err := ParseBoxes(output.Bytes())
+	if err != nil {
+		t.Errorf("Mux output cannot be parsed: %v", err)
+		return
+	}
+
+	types := []string{}
+	for _, b := range boxes {
+		types = append(types, b.Type)
+	}
+	expectedTypes := []string{"ftyp", "moov"}
+	for i := 0; i < 8; i++ {
+		expectedTypes = append(expectedTypes, "moof", "mdat")
+	}
+	if !reflect.DeepEqual(expectedTypes, types) {
+		t.Errorf("Mux boxes do not match.\nexpected: %v\nactual:   %v", expectedTypes, types)
+		return
+	}
+
+	moov := boxes[1]
+	traks := moov.ChildrenOf("trak")
+	if len(traks) != 2 {
+		t.Errorf("Mux moov must have 2 traks: %d", len(traks))
+		return
+	}
+	for i, trak := range traks {
+		trackId, _ := trak.Child("tkhd").uint32At(12)
+		trexId, _ := moov.Find("mvex").ChildrenOf("trex")[i].uint32At(4)
+		if trackId != uint32(i+1) || trexId != uint32(i+1) {
+			t.Errorf("Mux track %d has id %d and trex id %d", i+1, trackId, trexId)
+		}
+	}
+
+	nextTrackId, _ := moov.Child("mvhd").uint32At(len(moov.Child("mvhd").Data) - 4)
+	if nextTrackId != 3 {
+		t.Errorf("Mux next track id does not match.\nexpected: %v\nactual:   %v", 3, nextTrackId)
+	}
+
+	expectedPayloads := []string{"v0", "a0", "a1", "v1", "a2", "a3", "v2", "a4"}
+	expectedTrackIds := []uint32{1, 2, 2, 1, 2, 2, 1, 2}
+	for i := 0; i < 8; i++ {
+		moof := boxes[2+i*2]
+		mdat := boxes[3+i*2]
+
+		sequenceNumber, _ := moof.Child("mfhd").uint32At(4)
+		trackId, _ := moof.Find("traf", "tfhd").uint32At(4)
+		if sequenceNumber != uint32(i+1) || trackId != expectedTrackIds[i] || string(mdat.Data) != expectedPayloads[i] {
+			t.Errorf("Mux fragment %d does not match.\nexpected: %v %v %v\nactual:   %v %v %v", i, i+1, expectedTrackIds[i], expectedPayloads[i], sequenceNumber, trackId, string(mdat.Data))
+		}
+	}
+}
+
+func TestMuxRebasesBaseDataOffset(t *testing.T) {
+	buf := new(bytes.Buffer)
+	(&Box{Type: "ftyp", Data: []byte("iso6\x00\x00\x00\x00")}).WriteTo(buf)
+	(&Box{Type: "moov", Children: []*Box{
+		{Type: "mvhd", Data: fullBoxData(0, 0, uint32(0), uint32(0), uint32(1000), uint32(0), make([]byte, 76), uint32(2))},
+		{Type: "trak", Children: []*Box{
+			{Type: "tkhd", Data: fullBoxData(0, 3, uint32(0), uint32(0), uint32(1), uint32(0), uint32(0), make([]byte, 60))},
+			{Type: "mdia", Children: []*Box{
+				{Type: "mdhd", Data: fullBoxData(0, 0, uint32(0), uint32(0), uint32(1000), uint32(0), uint32(0))},
+			}},
+		}},
+	}}).WriteTo(buf)
+	(&Box{Type: "free", Data: make([]byte, 100)}).WriteTo(buf)
+
+	moofOffset := uint64(buf.Len())
+	(&Box{Type: "moof", Children: []*Box{
+		{Type: "mfhd", Data: fullBoxData(0, 0, uint32(1))},
+		{Type: "traf", Children: []*Box{
+			{Type: "tfhd", Data: fullBoxData(0, TfhdBaseDataOffsetPresent, uint32(1), moofOffset+10)},
+		}},
+	}}).WriteTo(buf)
+	(&Box{Type: "mdat", Data: []byte("0123456789")}).WriteTo(buf)
+
+	output := new(bytes.Buffer)
+	err := Mux(output, buf)
+	if err != nil {
+		t.Errorf("Mux failed: %v", err)
+		return
+	}
+
+	boxes, _ := ParseBoxes(output.Bytes())
+	var newMoofOffset uint64
+	for _, b := range boxes {
+		if b.Type == "moof" {
+			break
+		}
+		newMoofOffset += uint64(b.Size())
+	}
+
+	baseDataOffset, _ := boxes[2].Find("traf", "tfhd").uint64At(8)
+	if baseDataOffset != newMoofOffset+10 {
+		t.Errorf("Mux base data offset does not match.\nexpected: %v\nactual:   %v", newMoofOffset+10, baseDataOffset)
+	}
+}
+
+func TestRescale(t *testing.T) {
+	cases := []struct {
+		v        uint64
+		from, to uint32
+		expected uint64
+	}{
+		{1000, 1000, 90000, 90000},
+		{90000, 90000, 1000, 1000},
+		{12345, 1000, 1000, 12345},
+		{1 << 62, 1, 1000, 1<<64 - 1},
+	}
+
+	for _, c := range cases {
+		actual := rescale(c.v, c.from, c.to)
+		if actual != c.expected {
+			t.Errorf("rescale(%v, %v, %v) does not match.\nexpected: %v\nactual:   %v", c.v, c.from, c.to, c.expected, actual)
+		}
+	}
+}
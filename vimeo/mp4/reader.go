@@ -0,0 +1,119 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mp4
+
+import (
+	"encoding/binary"
+)
+
+// fieldReader reads big-endian fields from a box payload. The first read
+// past the end sets err and every later read returns zero, so that parsers
+// only need to check err once.
+type fieldReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func newFieldReader(data []byte) *fieldReader {
+	return &fieldReader{data: data}
+}
+
+func (r *fieldReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+
+	if n < 0 || len(r.data)-r.pos < n {
+		r.err = ErrShortBox
+		return nil
+	}
+
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *fieldReader) skip(n int) {
+	r.bytes(n)
+}
+
+func (r *fieldReader) remaining() int {
+	return len(r.data) - r.pos
+}
+
+func (r *fieldReader) uint8() uint8 {
+	b := r.bytes(1)
+	if b == nil {
+		return 0
+	}
+
+	return b[0]
+}
+
+func (r *fieldReader) uint16() uint16 {
+	b := r.bytes(2)
+	if b == nil {
+		return 0
+	}
+
+	return binary.BigEndian.Uint16(b)
+}
+
+func (r *fieldReader) uint24() uint32 {
+	b := r.bytes(3)
+	if b == nil {
+		return 0
+	}
+
+	return uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+}
+
+func (r *fieldReader) uint32() uint32 {
+	b := r.bytes(4)
+	if b == nil {
+		return 0
+	}
+
+	return binary.BigEndian.Uint32(b)
+}
+
+func (r *fieldReader) uint64() uint64 {
+	b := r.bytes(8)
+	if b == nil {
+		return 0
+	}
+
+	return binary.BigEndian.Uint64(b)
+}
+
+// uint reads a field which is 64-bit in version 1 boxes and 32-bit otherwise.
+func (r *fieldReader) uint(wide bool) uint64 {
+	if wide {
+		return r.uint64()
+	}
+
+	return uint64(r.uint32())
+}
+
+func (r *fieldReader) fourCC() string {
+	return string(r.bytes(4))
+}
+
+// fullBox reads the version and flags of a full box.
+func (r *fieldReader) fullBox() (uint8, uint32) {
+	v := r.uint32()
+	return uint8(v >> 24), v & 0x00ffffff
+}
@@ -0,0 +1,100 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mp4
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ShiftTimestamps moves the fragments in data (media segments) earlier by
+// seconds, by rewriting the decode times of tfdt and the earliest
+// presentation times of sidx in place. timescales maps track ids to the
+// timescales of their mdhd. Times before zero are clamped to zero.
+func ShiftTimestamps(data []byte, seconds float64, timescales map[uint32]uint32) error {
+	boxes, err := ParseBoxes(data)
+	if err != nil {
+		return err
+	}
+
+	for _, box := range boxes {
+		switch box.Type {
+		case "sidx":
+			timescale, err := box.uint32At(8)
+			if err != nil {
+				return err
+			}
+
+			err = shiftField(box, 12, seconds, timescale)
+			if err != nil {
+				return err
+			}
+		case "moof":
+			for _, traf := range box.ChildrenOf("traf") {
+				tfhd := traf.Child("tfhd")
+				if tfhd == nil {
+					return errors.New("mp4: traf box has no tfhd")
+				}
+
+				trackId, err := tfhd.uint32At(4)
+				if err != nil {
+					return err
+				}
+
+				timescale, ok := timescales[trackId]
+				if !ok {
+					return fmt.Errorf("mp4: fragment refers to unknown track %d", trackId)
+				}
+
+				if tfdt := traf.Child("tfdt"); tfdt != nil {
+					err = shiftField(tfdt, 4, seconds, timescale)
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Timescales returns the timescale of each track by its id.
+func (info *Info) Timescales() map[uint32]uint32 {
+	timescales := map[uint32]uint32{}
+	for _, t := range info.Tracks {
+		timescales[t.Id] = t.Timescale
+	}
+
+	return timescales
+}
+
+func shiftField(b *Box, offset int, seconds float64, timescale uint32) error {
+	wide := b.Version() == 1
+	v, err := b.uintAt(offset, wide)
+	if err != nil {
+		return err
+	}
+
+	delta := uint64(math.Round(seconds * float64(timescale)))
+	if delta > v {
+		v = 0
+	} else {
+		v -= delta
+	}
+
+	return b.putUintAt(offset, wide, v)
+}
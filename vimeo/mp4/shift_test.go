@@ -0,0 +1,63 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mp4
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestShiftTimestamps(t *testing.T) {
+	data := newTestFile(1, "vide", 90000, []uint64{900000, 990000}, []string{"a", "b"})
+
+	err := ShiftTimestamps(data, 10.5, map[uint32]uint32{1: 90000})
+	if err != nil {
+		t.Errorf("ShiftTimestamps failed: %v", err)
+		return
+	}
+
+	info, err := InspectBytes(data)
+	if err != nil {
+		t.Errorf("InspectBytes failed: %v", err)
+		return
+	}
+
+	expected := []uint64{0, 45000}
+	actual := []uint64{}
+	for _, f := range info.Fragments {
+		actual = append(actual, f.Tracks[0].BaseMediaDecodeTime)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("tfdt does not match.\nexpected: %v\nactual:   %v", expected, actual)
+	}
+
+	expected = []uint64{0, 45000}
+	actual = []uint64{}
+	for _, sidx := range info.Indexes {
+		actual = append(actual, sidx.EarliestPresentationTime)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("sidx does not match.\nexpected: %v\nactual:   %v", expected, actual)
+	}
+}
+
+func TestShiftTimestampsWithUnknownTrack(t *testing.T) {
+	data := newTestFile(2, "soun", 48000, []uint64{0}, []string{"a"})
+
+	err := ShiftTimestamps(data, 1, map[uint32]uint32{1: 48000})
+	if err == nil {
+		t.Errorf("ShiftTimestamps must fail for unknown tracks")
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vimeo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/akiomik/vimeo-dl/vimeo/mp4"
+)
+
+// OverwritePolicy decides what happens to outputs which already exist.
+type OverwritePolicy int
+
+const (
+	// NoOverwrite fails the download.
+	NoOverwrite OverwritePolicy = iota
+	// Overwrite replaces the outputs.
+	Overwrite
+	// SkipExisting skips the download when every output exists.
+	SkipExisting
+)
+
+// partFilename is where an output is written until it is complete.
+func partFilename(filename string) string {
+	return filename + ".part"
+}
+
+// outputLocks are the outputs which are being downloaded in this process,
+// each with a channel which is closed when the download ends.
+var outputLocks = struct {
+	sync.Mutex
+	inFlight map[string]chan struct{}
+}{inFlight: map[string]chan struct{}{}}
+
+// lockOutput waits until no other download in this process writes to
+// filename (the name of the outputs without an extension), e.g. a parallel
+// batch job of the same clip, and returns a func which releases it. Two
+// downloads would otherwise write the same part and state files.
+func lockOutput(ctx context.Context, filename string) (func(), error) {
+	key, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		outputLocks.Lock()
+		done, ok := outputLocks.inFlight[key]
+		if !ok {
+			done = make(chan struct{})
+			outputLocks.inFlight[key] = done
+			outputLocks.Unlock()
+
+			return func() {
+				outputLocks.Lock()
+				delete(outputLocks.inFlight, key)
+				outputLocks.Unlock()
+				close(done)
+			}, nil
+		}
+		outputLocks.Unlock()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// checkOutputs applies policy to the final outputs of a download, and
+// reports whether the download should be skipped.
+func checkOutputs(policy OverwritePolicy, filenames []string) (bool, error) {
+	if policy == Overwrite {
+		return false, nil
+	}
+
+	existing := []string{}
+	for _, filename := range filenames {
+		_, err := os.Stat(filename)
+		if err == nil {
+			existing = append(existing, filename)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return false, err
+		}
+	}
+
+	if len(existing) == 0 {
+		return false, nil
+	}
+
+	if policy == SkipExisting && len(existing) == len(filenames) {
+		return true, nil
+	}
+
+	return false, fmt.Errorf("%s: %w", existing[0], fs.ErrExist)
+}
+
+// openOutput creates a new part file, or reopens an existing one positioned
+// at the end of the last completed segment when resumed. A part file left by
+// a run which is not resumed is discarded.
+func openOutput(filename string, progress *TrackState, resumed bool) (*os.File, error) {
+	if !resumed {
+		return os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	}
+
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	// drop a half-written segment
+	err = file.Truncate(progress.Offset)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	_, err = file.Seek(progress.Offset, io.SeekStart)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// closeOutput flushes file to disk before closing it, so that a part file
+// is never renamed into place with data which is not written yet.
+func closeOutput(file *os.File) error {
+	err := file.Sync()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// commitOutput moves a completed part file into place, replacing filename
+// if it exists.
+func commitOutput(partFilename string, filename string) error {
+	err := os.Rename(partFilename, filename)
+	if err != nil {
+		return err
+	}
+
+	// make the rename durable as well; not every platform can sync a
+	// directory, so this is best effort
+	dir, err := os.Open(filepath.Dir(filename))
+	if err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	return nil
+}
+
+// muxFiles combines fragmented mp4 files into outputFilename through a part
+// file. All files are closed on return so that the inputs can be removed
+// afterwards.
+func muxFiles(outputFilename string, inputFilenames ...string) error {
+	inputs := make([]io.Reader, len(inputFilenames))
+	for i, filename := range inputFilenames {
+		file, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		inputs[i] = file
+	}
+
+	outputPartFilename := partFilename(outputFilename)
+	outputFile, err := os.OpenFile(outputPartFilename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	err = mp4.Mux(outputFile, inputs...)
+	if err == nil {
+		err = closeOutput(outputFile)
+	} else {
+		outputFile.Close()
+	}
+	if err != nil {
+		os.Remove(outputPartFilename)
+		return err
+	}
+
+	return commitOutput(outputPartFilename, outputFilename)
+}
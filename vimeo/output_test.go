@@ -0,0 +1,121 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vimeo
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpenOutputResumesAtOffset(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "video.mp4.part")
+	os.WriteFile(filename, []byte("initseg1half"), 0644)
+
+	file, err := openOutput(filename, &TrackState{Segments: 1, Offset: 8}, true)
+	if err != nil {
+		t.Errorf("openOutput failed: %v", err)
+		return
+	}
+	file.Write([]byte("seg2"))
+	file.Close()
+
+	expected := "initseg1seg2"
+	actual, _ := os.ReadFile(filename)
+	if string(actual) != expected {
+		t.Errorf("openOutput output does not match.\nexpected: %v\nactual:   %v", expected, string(actual))
+		return
+	}
+}
+
+func TestOpenOutputDiscardsStalePart(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "video.mp4.part")
+	os.WriteFile(filename, []byte("stale"), 0644)
+
+	file, err := openOutput(filename, &TrackState{}, false)
+	if err != nil {
+		t.Errorf("openOutput failed: %v", err)
+		return
+	}
+	file.Write([]byte("new"))
+	file.Close()
+
+	actual, _ := os.ReadFile(filename)
+	if string(actual) != "new" {
+		t.Errorf("openOutput must truncate a stale part file: %s", actual)
+		return
+	}
+}
+
+func TestCommitOutput(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "video.mp4")
+	os.WriteFile(filename, []byte("old"), 0644)
+	os.WriteFile(partFilename(filename), []byte("new"), 0644)
+
+	err := commitOutput(partFilename(filename), filename)
+	if err != nil {
+		t.Errorf("commitOutput failed: %v", err)
+		return
+	}
+
+	actual, _ := os.ReadFile(filename)
+	if string(actual) != "new" {
+		t.Errorf("commitOutput must replace the output: %s", actual)
+		return
+	}
+
+	if _, err := os.Stat(partFilename(filename)); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("commitOutput must remove the part file: %v", err)
+		return
+	}
+}
+
+func TestLockOutput(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "clip1")
+	unlock, err := lockOutput(context.Background(), filename)
+	if err != nil {
+		t.Errorf("lockOutput failed: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = lockOutput(ctx, filename)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("lockOutput must wait for a locked output: %v", err)
+		return
+	}
+
+	locked := make(chan error)
+	go func() {
+		unlockAgain, err := lockOutput(context.Background(), filename)
+		if err == nil {
+			unlockAgain()
+		}
+		locked <- err
+	}()
+
+	unlock()
+	err = <-locked
+	if err != nil {
+		t.Errorf("lockOutput must succeed once the output is unlocked: %v", err)
+		return
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vimeo
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxFilenameLength is the limit of a path element on most file systems, in
+// bytes.
+const maxFilenameLength = 255
+
+// SanitizeFilename turns a name from remote data, e.g. a clip id, into a
+// single safe path element. Path separators, control characters and
+// characters reserved on Windows are replaced with '_', leading dots are
+// removed, and reserved device names such as CON are prefixed with '_'.
+func SanitizeFilename(name string) string {
+	sanitized := strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+
+	// leading dots would make hidden files, or "." and ".."
+	sanitized = strings.TrimLeft(strings.TrimSpace(sanitized), ".")
+	if len(sanitized) == 0 {
+		return "_"
+	}
+
+	if isReservedFilename(sanitized) {
+		sanitized = "_" + sanitized
+	}
+
+	for len(sanitized) > maxFilenameLength {
+		_, size := utf8.DecodeLastRuneInString(sanitized)
+		sanitized = sanitized[:len(sanitized)-size]
+	}
+
+	return sanitized
+}
+
+// isReservedFilename reports whether name is a device name on Windows, with
+// or without an extension.
+func isReservedFilename(name string) bool {
+	base, _, _ := strings.Cut(name, ".")
+	base = strings.ToUpper(strings.TrimRight(base, " "))
+	switch base {
+	case "CON", "PRN", "AUX", "NUL":
+		return true
+	}
+
+	if len(base) == 4 && (strings.HasPrefix(base, "COM") || strings.HasPrefix(base, "LPT")) {
+		return base[3] >= '1' && base[3] <= '9'
+	}
+
+	return false
+}
+
+// OutputPath resolves name against dir and makes sure that the result is
+// inside dir, so that neither a template nor a name from remote data can
+// write elsewhere. Absolute names are allowed as long as they are in dir.
+func OutputPath(dir string, name string) (string, error) {
+	if len(name) == 0 {
+		return "", fmt.Errorf("output path is empty")
+	}
+	if len(dir) == 0 {
+		dir = "."
+	}
+
+	path := filepath.Clean(name)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(absDir, absPath)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("output path '%s' is outside of the output directory '%s'", name, dir)
+	}
+
+	for _, element := range strings.Split(rel, string(filepath.Separator)) {
+		if isReservedFilename(element) {
+			return "", fmt.Errorf("output path '%s' contains a reserved name '%s'", name, element)
+		}
+	}
+
+	return path, nil
+}
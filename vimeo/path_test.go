@@ -0,0 +1,97 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vimeo
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"clip1", "clip1"},
+		{"a/b\\c", "a_b_c"},
+		{"what?<x>|\"*", "what__x____"},
+		{"tab\there", "tab_here"},
+		{"..", "_"},
+		{"../../etc/x", "_.._etc_x"},
+		{".hidden", "hidden"},
+		{"  ", "_"},
+		{"CON", "_CON"},
+		{"com1.mp4", "_com1.mp4"},
+		{"console", "console"},
+		{strings.Repeat("あ", 100), strings.Repeat("あ", 85)},
+	}
+
+	for _, test := range tests {
+		actual := SanitizeFilename(test.name)
+		if actual != test.expected {
+			t.Errorf("SanitizeFilename(%q) does not match.\nexpected: %v\nactual:   %v", test.name, test.expected, actual)
+			return
+		}
+	}
+}
+
+func TestOutputPath(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"clip1", filepath.Join(dir, "clip1")},
+		{"clip1/720p", filepath.Join(dir, "clip1", "720p")},
+		{"a/../clip1", filepath.Join(dir, "clip1")},
+		{filepath.Join(dir, "clip1"), filepath.Join(dir, "clip1")},
+	}
+
+	for _, test := range tests {
+		actual, err := OutputPath(dir, test.name)
+		if err != nil {
+			t.Errorf("OutputPath(%q) failed: %v", test.name, err)
+			return
+		}
+
+		if actual != test.expected {
+			t.Errorf("OutputPath(%q) does not match.\nexpected: %v\nactual:   %v", test.name, test.expected, actual)
+			return
+		}
+	}
+}
+
+func TestOutputPathRejectsUnsafePaths(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{
+		"",
+		".",
+		"..",
+		"../../etc/x",
+		"clip1/../../x",
+		filepath.Join(filepath.Dir(dir), "x"),
+		"nul",
+		"clip1/aux.mp4",
+	}
+
+	for _, name := range names {
+		_, err := OutputPath(dir, name)
+		if err == nil {
+			t.Errorf("OutputPath(%q) must fail", name)
+			return
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vimeo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+)
+
+// PlayerConfig is the part of the config json of the Vimeo player which
+// locates master.json.
+type PlayerConfig struct {
+	Request struct {
+		Files struct {
+			Dash PlayerFiles `json:"dash"`
+		} `json:"files"`
+	} `json:"request"`
+	Video struct {
+		Id    int64  `json:"id"`
+		Title string `json:"title"`
+	} `json:"video"`
+}
+
+type PlayerFiles struct {
+	SeparateAv bool           `json:"separate_av"`
+	DefaultCdn string         `json:"default_cdn"`
+	Cdns       map[string]Cdn `json:"cdns"`
+}
+
+type Cdn struct {
+	Url    string `json:"url"`
+	AvcUrl string `json:"avc_url,omitempty"`
+	Origin string `json:"origin,omitempty"`
+}
+
+func ParsePlayerConfig(data []byte) (*PlayerConfig, error) {
+	config := new(PlayerConfig)
+	err := json.Unmarshal(data, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(config.Request.Files.Dash.Cdns) == 0 {
+		return nil, errors.New("player config has no dash cdns")
+	}
+
+	return config, nil
+}
+
+// CdnNames returns the names of the cdns, starting with the default one.
+func (pc *PlayerConfig) CdnNames() []string {
+	dash := pc.Request.Files.Dash
+	names := []string{}
+	for name := range dash.Cdns {
+		if name != dash.DefaultCdn {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	if _, ok := dash.Cdns[dash.DefaultCdn]; ok {
+		names = append([]string{dash.DefaultCdn}, names...)
+	}
+
+	return names
+}
+
+// MasterJsonUrl returns the master.json url of the given cdn, or of the
+// default cdn if cdn is empty.
+func (pc *PlayerConfig) MasterJsonUrl(cdn string) (*url.URL, error) {
+	if len(cdn) == 0 {
+		cdn = pc.CdnNames()[0]
+	}
+
+	c, ok := pc.Request.Files.Dash.Cdns[cdn]
+	if !ok {
+		return nil, fmt.Errorf("cdn '%s' is not found in the player config (available: %v)", cdn, pc.CdnNames())
+	}
+
+	if len(c.Url) == 0 {
+		return nil, fmt.Errorf("cdn '%s' has no url", cdn)
+	}
+
+	return url.Parse(c.Url)
+}
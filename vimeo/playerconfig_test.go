@@ -0,0 +1,101 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vimeo
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func loadPlayerConfig() (*PlayerConfig, error) {
+	data, err := os.ReadFile("testdata/player_config.json")
+	if err != nil {
+		return nil, err
+	}
+
+	return ParsePlayerConfig(data)
+}
+
+func TestParsePlayerConfig(t *testing.T) {
+	config, err := loadPlayerConfig()
+	if err != nil {
+		t.Errorf("ParsePlayerConfig failed: %v", err)
+		return
+	}
+
+	if config.Video.Id != 123 || config.Video.Title != "Example video" {
+		t.Errorf("ParsePlayerConfig video does not match: %v", config.Video)
+	}
+
+	expected := []string{"akfire_interconnect_quic", "fastly_skyfire"}
+	actual := config.CdnNames()
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("CdnNames does not match.\nexpected: %v\nactual:   %v", expected, actual)
+	}
+}
+
+func TestPlayerConfigMasterJsonUrl(t *testing.T) {
+	config, err := loadPlayerConfig()
+	if err != nil {
+		t.Errorf("ParsePlayerConfig failed: %v", err)
+		return
+	}
+
+	cases := []struct {
+		cdn      string
+		expected string
+	}{
+		{"", "https://vod-adaptive-ak.vimeocdn.com/exp=1700000000~acl=%2F123%2F%2A~hmac=abc/123/sep/video/d1f5ed5b,9a0b5f6e/master.json?base64_init=1"},
+		{"fastly_skyfire", "https://skyfire.vimeocdn.com/1700000000-0xdef/123/sep/video/d1f5ed5b,9a0b5f6e/master.json?base64_init=1"},
+	}
+
+	for _, c := range cases {
+		actual, err := config.MasterJsonUrl(c.cdn)
+		if err != nil {
+			t.Errorf("MasterJsonUrl failed for '%s': %v", c.cdn, err)
+			continue
+		}
+
+		if actual.String() != c.expected {
+			t.Errorf("MasterJsonUrl does not match for '%s'.\nexpected: %v\nactual:   %v", c.cdn, c.expected, actual)
+		}
+	}
+
+	_, err = config.MasterJsonUrl("unknown")
+	if err == nil {
+		t.Errorf("MasterJsonUrl must fail for unknown cdns")
+	}
+}
+
+func TestPlayerConfigWithoutDefaultCdn(t *testing.T) {
+	config, err := ParsePlayerConfig([]byte(`{"request":{"files":{"dash":{"cdns":{"b":{"url":"https://b.example.com/master.json"},"a":{"url":"https://a.example.com/master.json"}}}}}}`))
+	if err != nil {
+		t.Errorf("ParsePlayerConfig failed: %v", err)
+		return
+	}
+
+	actual, err := config.MasterJsonUrl("")
+	if err != nil || actual.String() != "https://a.example.com/master.json" {
+		t.Errorf("MasterJsonUrl does not match (%v).\nexpected: %v\nactual:   %v", err, "https://a.example.com/master.json", actual)
+	}
+}
+
+func TestParsePlayerConfigWithoutCdns(t *testing.T) {
+	_, err := ParsePlayerConfig([]byte(`{"request":{"files":{"hls":{}}}}`))
+	if err == nil {
+		t.Errorf("ParsePlayerConfig must fail without dash cdns")
+	}
+}
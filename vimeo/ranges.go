@@ -0,0 +1,57 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vimeo
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// parseByteRange parses "first-last" of master.json, whose bounds are
+// inclusive like the Range header.
+func parseByteRange(r string) (int64, int64, error) {
+	parts := strings.SplitN(r, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid byte range '%s'", r)
+	}
+
+	first, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid byte range '%s'", r)
+	}
+
+	last, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || first < 0 || last < first {
+		return 0, 0, fmt.Errorf("invalid byte range '%s'", r)
+	}
+
+	return first, last, nil
+}
+
+// withRange returns u with a range query, unless u already has one.
+func withRange(u *url.URL, r string) *url.URL {
+	query := u.Query()
+	if query.Has("range") {
+		return u
+	}
+
+	ranged := *u
+	query.Set("range", r)
+	ranged.RawQuery = query.Encode()
+
+	return &ranged
+}
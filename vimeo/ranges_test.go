@@ -0,0 +1,70 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vimeo
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestParseByteRange(t *testing.T) {
+	first, last, err := parseByteRange("1000-1999")
+	if err != nil || first != 1000 || last != 1999 {
+		t.Errorf("parseByteRange does not match (%v).\nexpected: %v-%v\nactual:   %v-%v", err, 1000, 1999, first, last)
+	}
+
+	for _, r := range []string{"", "100", "a-b", "200-100", "-1-10"} {
+		_, _, err := parseByteRange(r)
+		if err == nil {
+			t.Errorf("parseByteRange must fail for '%s'", r)
+		}
+	}
+}
+
+func TestWithRange(t *testing.T) {
+	cases := []struct {
+		url      string
+		expected string
+	}{
+		{"https://example.com/1080p.mp4", "https://example.com/1080p.mp4?range=0-99"},
+		{"https://example.com/1080p.mp4?foo=bar", "https://example.com/1080p.mp4?foo=bar&range=0-99"},
+		{"https://example.com/1080p.mp4?range=100-199", "https://example.com/1080p.mp4?range=100-199"},
+	}
+
+	for _, c := range cases {
+		u, _ := url.Parse(c.url)
+		actual := withRange(u, "0-99").String()
+		if actual != c.expected {
+			t.Errorf("withRange does not match.\nexpected: %v\nactual:   %v", c.expected, actual)
+		}
+		if u.String() != c.url {
+			t.Errorf("withRange must not modify its argument: %v", u)
+		}
+	}
+}
+
+func TestEstimatedSizeWithByteRanges(t *testing.T) {
+	video := Video{
+		Segments: []Segment{
+			Segment{Range: "100-199"},
+			Segment{Range: "200-349"},
+		},
+	}
+
+	actual := video.EstimatedSize()
+	if actual != 250 {
+		t.Errorf("EstimatedSize does not match.\nexpected: %v\nactual:   %v", 250, actual)
+	}
+}
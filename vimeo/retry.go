@@ -0,0 +1,154 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vimeo
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const maxBackoff = 24 * time.Hour
+
+type RetryPolicy struct {
+	MaxAttempts          int
+	BaseDelay            time.Duration
+	MaxDelay             time.Duration
+	RetryableStatusCodes []int
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 4,
+		BaseDelay:   time.Second,
+		MaxDelay:    30 * time.Second,
+		RetryableStatusCodes: []int{
+			http.StatusRequestTimeout,
+			http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+	}
+}
+
+// IsRetryable reports whether err is worth another attempt. A ProtocolError
+// never is, and other errors than HTTPError are transport errors such as
+// connection resets.
+func (p *RetryPolicy) IsRetryable(err error) bool {
+	var protocolErr *ProtocolError
+	if errors.As(err, &protocolErr) {
+		return false
+	}
+
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		return true
+	}
+
+	for _, code := range p.RetryableStatusCodes {
+		if httpErr.StatusCode == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Delay returns the wait time before the given retry (starting from 1).
+// A Retry-After header on err takes precedence over the exponential backoff,
+// but it is capped at MaxDelay as well, so that a server cannot make a
+// download wait for hours.
+func (p *RetryPolicy) Delay(retry int, err error) time.Duration {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		if delay, ok := parseRetryAfter(httpErr.Header.Get("Retry-After")); ok {
+			if p.MaxDelay > 0 && delay > p.MaxDelay {
+				return p.MaxDelay
+			}
+			return delay
+		}
+	}
+
+	delay := p.BaseDelay
+	for i := 1; i < retry && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	// equal jitter: somewhere between delay/2 and delay
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if len(value) == 0 {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		delay := time.Until(date)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+
+	return 0, false
+}
+
+// retry calls fn until it succeeds or fails with an error which is not
+// retryable. The delays between attempts are cut short when ctx is done.
+func (c *Client) retry(ctx context.Context, description string, fn func() error) error {
+	attempts := c.Retry.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = fn()
+		if err == nil || attempt == attempts || ctx.Err() != nil || !c.Retry.IsRetryable(err) {
+			break
+		}
+
+		delay := c.Retry.Delay(attempt, err)
+		if c.Hooks.Retry != nil {
+			c.Hooks.Retry(RetryEvent{Description: description, Attempt: attempt + 1, MaxAttempts: attempts, Delay: delay, Err: err})
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+
+	return err
+}
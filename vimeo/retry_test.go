@@ -0,0 +1,176 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vimeo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyIsRetryable(t *testing.T) {
+	policy := DefaultRetryPolicy()
+
+	cases := map[error]bool{
+		errors.New("connection reset by peer"):                            true,
+		&HTTPError{StatusCode: http.StatusTooManyRequests}:                true,
+		&HTTPError{StatusCode: http.StatusServiceUnavailable}:             true,
+		&HTTPError{StatusCode: http.StatusNotFound}:                       false,
+		&HTTPError{StatusCode: http.StatusForbidden}:                      false,
+		&SegmentError{Err: &HTTPError{StatusCode: http.StatusBadGateway}}: true,
+		&ProtocolError{Message: "the server ignored the Range header"}:    false,
+	}
+
+	for err, expected := range cases {
+		actual := policy.IsRetryable(err)
+		if actual != expected {
+			t.Errorf("IsRetryable does not match for %v.\nexpected: %v\nactual:   %v", err, expected, actual)
+		}
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+
+	for retry, upper := range []time.Duration{1, 2, 4, 5, 5} {
+		upper *= time.Second
+		delay := policy.Delay(retry+1, errors.New("error"))
+		if delay < upper/2 || delay > upper {
+			t.Errorf("Delay for retry %d must be between %v and %v: %v", retry+1, upper/2, upper, delay)
+		}
+	}
+
+	err := &HTTPError{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": []string{"3"}}}
+	delay := policy.Delay(1, err)
+	if delay != 3*time.Second {
+		t.Errorf("Delay must honour Retry-After.\nexpected: %v\nactual:   %v", 3*time.Second, delay)
+	}
+
+	err = &HTTPError{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": []string{"7200"}}}
+	delay = policy.Delay(1, err)
+	if delay != policy.MaxDelay {
+		t.Errorf("Delay must cap Retry-After at MaxDelay.\nexpected: %v\nactual:   %v", policy.MaxDelay, delay)
+	}
+}
+
+func TestDownloadSegmentsRetriesTransientErrors(t *testing.T) {
+	var mu sync.Mutex
+	requests := map[string]int{}
+
+	client := NewClient()
+	client.Retry.BaseDelay = 0
+	client.Client = NewMockClient(func(req *http.Request) *http.Response {
+		mu.Lock()
+		defer mu.Unlock()
+
+		requests[req.URL.Path]++
+		if requests[req.URL.Path] < 3 {
+			return NewMockReponseWithStatus(http.StatusServiceUnavailable, "")
+		}
+		return NewMockReponseFromString(req.URL.Path)
+	})
+
+	url0, _ := url.Parse("https://example.com/segment-1.m4s")
+	url1, _ := url.Parse("https://example.com/segment-2.m4s")
+	output := new(bytes.Buffer)
+	err := client.downloadSegments(context.Background(), TrackEvent{}, []*url.URL{url0, url1}, 0, output, nil, nil)
+	if err != nil {
+		t.Errorf("downloadSegments failed: %v", err)
+		return
+	}
+
+	expected := "/segment-1.m4s/segment-2.m4s"
+	if output.String() != expected {
+		t.Errorf("downloadSegments output does not match.\nexpected: %v\nactual:   %v", expected, output.String())
+		return
+	}
+}
+
+func TestGetMasterJsonGivesUpOnPermanentErrors(t *testing.T) {
+	count := 0
+	client := NewClient()
+	client.Retry.BaseDelay = 0
+	client.Client = NewMockClient(func(req *http.Request) *http.Response {
+		count++
+		return NewMockReponseWithStatus(http.StatusNotFound, "")
+	})
+
+	jsonUrl, _ := url.Parse("http://example.com/master.json")
+	_, err := client.GetMasterJson(jsonUrl)
+	if err == nil {
+		t.Errorf("GetMasterJson must fail on 404")
+		return
+	}
+
+	if count != 1 {
+		t.Errorf("GetMasterJson must not retry on 404: %d requests", count)
+		return
+	}
+}
+
+func TestGetMasterJsonContextStopsRetrying(t *testing.T) {
+	count := 0
+	client := NewClient()
+	client.Retry.BaseDelay = time.Hour
+	client.Retry.MaxDelay = time.Hour
+	client.Client = NewMockClient(func(req *http.Request) *http.Response {
+		count++
+		return NewMockReponseWithStatus(http.StatusServiceUnavailable, "")
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	jsonUrl, _ := url.Parse("http://example.com/master.json")
+	_, err := client.GetMasterJsonContext(ctx, jsonUrl)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetMasterJsonContext must fail with the context error: %v", err)
+		return
+	}
+
+	if count != 1 {
+		t.Errorf("GetMasterJsonContext must not retry after the deadline: %d requests", count)
+		return
+	}
+}
+
+func TestGetBytesGivesUpOnProtocolErrors(t *testing.T) {
+	count := 0
+	client := NewClient()
+	client.RangeHeader = true
+	client.Retry.BaseDelay = 0
+	client.Client = NewMockClient(func(req *http.Request) *http.Response {
+		count++
+		return NewMockReponseFromString("the whole file")
+	})
+
+	parcelUrl, _ := url.Parse("http://example.com/parcel/1080.mp4?range=0-9")
+	_, err := client.getBytes(context.Background(), "init segment", parcelUrl)
+	var protocolErr *ProtocolError
+	if !errors.As(err, &protocolErr) {
+		t.Errorf("getBytes must fail with ProtocolError: %v", err)
+		return
+	}
+
+	if count != 1 {
+		t.Errorf("getBytes must not retry a protocol error: %d requests", count)
+		return
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vimeo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sync"
+
+	"github.com/akiomik/vimeo-dl/vimeo/mp4"
+)
+
+type segmentResult struct {
+	body *bytes.Buffer
+	err  error
+}
+
+// downloadSegments fetches urls[start:] with up to c.Concurrency workers and
+// writes them to output in the original order, calling transform (if any) on
+// each downloaded segment and onWritten (if any) after each segment. At most
+// twice as many segments as workers are held in memory at any time. It stops
+// as soon as ctx is done.
+func (c *Client) downloadSegments(ctx context.Context, track TrackEvent, urls []*url.URL, start int, output io.Writer, transform func(data []byte) error, onWritten func(i int, n int64) error) error {
+	concurrency := c.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]chan segmentResult, len(urls))
+	for i := range results {
+		results[i] = make(chan segmentResult, 1)
+	}
+
+	window := make(chan struct{}, concurrency*2)
+	jobs := make(chan int)
+	done := make(chan struct{})
+
+	// workers retry with a context of their own, so that a failed segment
+	// stops the others instead of waiting for their retries
+	ctx, cancel := context.WithCancel(ctx)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer close(done)
+	defer cancel()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(jobs)
+
+		for i := start; i < len(urls); i++ {
+			select {
+			case window <- struct{}{}:
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
+
+			select {
+			case jobs <- i:
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				event := SegmentEvent{TrackEvent: track, Index: i, Url: urls[i].String()}
+				if c.Hooks.SegmentStarted != nil {
+					c.Hooks.SegmentStarted(event)
+				}
+
+				body := new(bytes.Buffer)
+				var w io.Writer = body
+				if c.Hooks.BytesReceived != nil {
+					w = &receiveWriter{w: body, event: event, hook: c.Hooks.BytesReceived}
+				}
+
+				err := c.retry(ctx, fmt.Sprintf("segment %d", i+1), func() error {
+					body.Reset()
+					return c.DownloadContext(ctx, urls[i], w)
+				})
+				if err == nil && transform != nil {
+					err = transform(body.Bytes())
+				}
+				results[i] <- segmentResult{body: body, err: err}
+			}
+		}()
+	}
+
+	for i := start; i < len(urls); i++ {
+		var result segmentResult
+		select {
+		case result = <-results[i]:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if result.err != nil {
+			return &SegmentError{Index: i, Url: urls[i].String(), Err: result.err}
+		}
+
+		n, err := result.body.WriteTo(output)
+		if err != nil {
+			return err
+		}
+
+		if c.Hooks.SegmentFinished != nil {
+			c.Hooks.SegmentFinished(SegmentEvent{TrackEvent: track, Index: i, Url: urls[i].String()}, n)
+		}
+
+		if onWritten != nil {
+			err = onWritten(i, n)
+			if err != nil {
+				return err
+			}
+		}
+
+		<-window
+	}
+
+	return nil
+}
+
+// resumeFile writes the init segment and the segments which are not in state
+// to output. timestampOffset is subtracted (in seconds) from the timestamps of
+// the segments, e.g. to make a trimmed file start at zero.
+func (c *Client) resumeFile(ctx context.Context, track TrackEvent, output io.Writer, initSegment []byte, urls []*url.URL, timestampOffset float64, state *TrackState, onProgress func(*TrackState) error) error {
+	if state.Offset == 0 {
+		n, err := output.Write(initSegment)
+		if err != nil {
+			return err
+		}
+
+		state.Segments = 0
+		state.Offset = int64(n)
+		if onProgress != nil {
+			err = onProgress(state)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if state.Segments > len(urls) {
+		return errors.New("resume state has more segments than the master.json")
+	}
+
+	var transform func([]byte) error
+	if timestampOffset > 0 {
+		info, err := mp4.InspectBytes(initSegment)
+		if err != nil {
+			return err
+		}
+
+		timescales := info.Timescales()
+		transform = func(data []byte) error {
+			return mp4.ShiftTimestamps(data, timestampOffset, timescales)
+		}
+	}
+
+	return c.downloadSegments(ctx, track, urls, state.Segments, output, transform, func(i int, n int64) error {
+		state.Segments = i + 1
+		state.Offset += n
+		if onProgress != nil {
+			return onProgress(state)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,182 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vimeo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownloadSegmentsKeepsOrder(t *testing.T) {
+	urls := make([]*url.URL, 20)
+	expected := new(bytes.Buffer)
+	for i := range urls {
+		urls[i], _ = url.Parse(fmt.Sprintf("https://example.com/segment-%d.m4s", i))
+		fmt.Fprintf(expected, "[%d]", i)
+	}
+
+	client := NewClient()
+	client.Concurrency = 4
+	client.Client = NewMockClient(func(req *http.Request) *http.Response {
+		var i int
+		fmt.Sscanf(req.URL.Path, "/segment-%d.m4s", &i)
+		// later segments finish first
+		time.Sleep(time.Duration(len(urls)-i) * time.Millisecond)
+		return NewMockReponseFromString("[" + strconv.Itoa(i) + "]")
+	})
+
+	output := new(bytes.Buffer)
+	err := client.downloadSegments(context.Background(), TrackEvent{}, urls, 0, output, nil, nil)
+	if err != nil {
+		t.Errorf("downloadSegments failed: %v", err)
+		return
+	}
+
+	if !bytes.Equal(expected.Bytes(), output.Bytes()) {
+		t.Errorf("downloadSegments output does not match.\nexpected: %s\nactual:   %s", expected.Bytes(), output.Bytes())
+		return
+	}
+}
+
+func TestDownloadSegmentsReportsFailedSegment(t *testing.T) {
+	urls := make([]*url.URL, 5)
+	for i := range urls {
+		urls[i], _ = url.Parse(fmt.Sprintf("https://example.com/segment-%d.m4s", i))
+	}
+
+	client := NewClient()
+	client.Concurrency = 2
+	client.Retry.MaxAttempts = 1
+	client.Client = NewMockClient(func(req *http.Request) *http.Response {
+		if req.URL.Path == "/segment-3.m4s" {
+			return NewMockReponseWithStatus(http.StatusInternalServerError, "")
+		}
+		return NewMockReponseFromString("ok")
+	})
+
+	output := new(bytes.Buffer)
+	err := client.downloadSegments(context.Background(), TrackEvent{}, urls, 0, output, nil, nil)
+
+	var segmentErr *SegmentError
+	if !errors.As(err, &segmentErr) || segmentErr.Index != 3 {
+		t.Errorf("downloadSegments err must be SegmentError for segment 3: %v", err)
+		return
+	}
+
+	if output.String() != "okokok" {
+		t.Errorf("downloadSegments must write segments before the failed one: %s", output.Bytes())
+		return
+	}
+}
+
+func TestDownloadSegmentsTransformsSegments(t *testing.T) {
+	url0, _ := url.Parse("https://example.com/segment-0.m4s")
+	url1, _ := url.Parse("https://example.com/segment-1.m4s")
+	expected := []byte("ABCDEF")
+
+	client := NewClient()
+	client.Concurrency = 2
+	client.Client = NewMockClient(func(req *http.Request) *http.Response {
+		if *req.URL == *url0 {
+			return NewMockReponseFromString("abc")
+		}
+		return NewMockReponseFromString("def")
+	})
+
+	output := new(bytes.Buffer)
+	err := client.downloadSegments(context.Background(), TrackEvent{}, []*url.URL{url0, url1}, 0, output, func(data []byte) error {
+		copy(data, bytes.ToUpper(data))
+		return nil
+	}, nil)
+	if err != nil {
+		t.Errorf("downloadSegments failed: %v", err)
+		return
+	}
+
+	if !bytes.Equal(expected, output.Bytes()) {
+		t.Errorf("downloadSegments output does not match.\nexpected: %s\nactual:   %s", expected, output.Bytes())
+		return
+	}
+}
+
+func TestDownloadSegmentsStopsWhenContextIsCanceled(t *testing.T) {
+	urls := make([]*url.URL, 5)
+	for i := range urls {
+		urls[i], _ = url.Parse(fmt.Sprintf("https://example.com/segment-%d.m4s", i))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := NewClient()
+	client.Client = NewMockClient(func(req *http.Request) *http.Response {
+		var i int
+		fmt.Sscanf(req.URL.Path, "/segment-%d.m4s", &i)
+		if i == 2 {
+			cancel()
+		}
+		return NewMockReponseFromString("[" + strconv.Itoa(i) + "]")
+	})
+
+	output := new(bytes.Buffer)
+	err := client.downloadSegments(ctx, TrackEvent{}, urls, 0, output, nil, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("downloadSegments must fail with context.Canceled: %v", err)
+		return
+	}
+
+	// segments 0 and 1 may be ready as the cancel is noticed, but never 2
+	if !strings.HasPrefix("[0][1]", output.String()) {
+		t.Errorf("downloadSegments must write only segments before the cancel: %s", output.Bytes())
+		return
+	}
+}
+
+func TestDownloadSegmentsStopsRetriesAfterAFailure(t *testing.T) {
+	url0, _ := url.Parse("https://example.com/segment-0.m4s")
+	url1, _ := url.Parse("https://example.com/segment-1.m4s")
+
+	client := NewClient()
+	client.Concurrency = 2
+	client.Retry.BaseDelay = time.Hour
+	client.Retry.MaxDelay = time.Hour
+	client.Client = NewMockClient(func(req *http.Request) *http.Response {
+		if req.URL.Path == "/segment-0.m4s" {
+			return NewMockReponseWithStatus(http.StatusNotFound, "")
+		}
+		return NewMockReponseWithStatus(http.StatusServiceUnavailable, "")
+	})
+
+	begin := time.Now()
+	err := client.downloadSegments(context.Background(), TrackEvent{}, []*url.URL{url0, url1}, 0, new(bytes.Buffer), nil, nil)
+	var segmentErr *SegmentError
+	if !errors.As(err, &segmentErr) || segmentErr.Index != 0 {
+		t.Errorf("downloadSegments must fail with the first segment: %v", err)
+		return
+	}
+
+	if elapsed := time.Since(begin); elapsed > time.Second {
+		t.Errorf("downloadSegments must not wait for the retries of other segments: %v", elapsed)
+		return
+	}
+}
@@ -0,0 +1,454 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vimeo
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Selector chooses a video and an audio from a MasterJson. Its syntax is
+// similar to the format selection of youtube-dl:
+//
+//	bestvideo[height<=1080]+bestaudio    a video and an audio
+//	height<=720,codec=avc1/best          fallbacks separated by '/'
+//	720p+bestaudio[channels=2]           an exact id
+//
+// A selector without '+' chooses only a video (or only an audio for
+// bestaudio and worstaudio).
+type Selector struct {
+	expr         string
+	alternatives [][]*formatSelector
+}
+
+type formatKind int
+
+const (
+	anyFormat formatKind = iota
+	videoFormat
+	audioFormat
+)
+
+type formatSelector struct {
+	kind    formatKind
+	worst   bool
+	id      string
+	filters []*formatFilter
+}
+
+type formatFilter struct {
+	field    string
+	op       string
+	value    string
+	optional bool
+}
+
+var selectorNames = map[string]formatSelector{
+	"best":       {kind: anyFormat},
+	"b":          {kind: anyFormat},
+	"worst":      {kind: anyFormat, worst: true},
+	"w":          {kind: anyFormat, worst: true},
+	"bestvideo":  {kind: videoFormat},
+	"bv":         {kind: videoFormat},
+	"worstvideo": {kind: videoFormat, worst: true},
+	"wv":         {kind: videoFormat, worst: true},
+	"bestaudio":  {kind: audioFormat},
+	"ba":         {kind: audioFormat},
+	"worstaudio": {kind: audioFormat, worst: true},
+	"wa":         {kind: audioFormat, worst: true},
+}
+
+var filterPattern = regexp.MustCompile(`^\s*([a-z_]+)\s*(<=|>=|!=|\^=|\$=|\*=|=|<|>)(\?)?\s*(.*?)\s*$`)
+
+func ParseSelector(expr string) (*Selector, error) {
+	selector := &Selector{expr: expr}
+
+	alternatives := splitTopLevel(expr, '/')
+	for i := 1; i < len(alternatives); i++ {
+		previous := splitTopLevel(alternatives[i-1], '+')
+		next := splitTopLevel(alternatives[i], '+')
+		err := checkSplitFilter(previous[len(previous)-1], '/', next[0])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, alternative := range alternatives {
+		parts := splitTopLevel(alternative, '+')
+		for i := 1; i < len(parts); i++ {
+			err := checkSplitFilter(parts[i-1], '+', parts[i])
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if len(parts) > 2 {
+			return nil, fmt.Errorf("invalid format '%s': only a video and an audio can be merged", alternative)
+		}
+
+		selectors := make([]*formatSelector, len(parts))
+		for i, part := range parts {
+			s, err := parseFormatSelector(part)
+			if err != nil {
+				return nil, err
+			}
+			selectors[i] = s
+		}
+
+		if len(selectors) == 2 && (selectors[0].kind == audioFormat || selectors[1].kind == videoFormat) {
+			return nil, fmt.Errorf("invalid format '%s': use video+audio", alternative)
+		}
+
+		selector.alternatives = append(selector.alternatives, selectors)
+	}
+
+	return selector, nil
+}
+
+// splitTopLevel splits s by sep outside of brackets.
+func splitTopLevel(s string, sep byte) []string {
+	parts := []string{}
+	depth := 0
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case sep:
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+// checkSplitFilter rejects a filter without brackets which is followed by
+// an id, e.g. mime_type=video/mp4, since the value was most likely split at
+// sep rather than followed by a fallback or an audio.
+func checkSplitFilter(filter string, sep byte, next string) error {
+	filter = strings.TrimSpace(filter)
+	next = strings.TrimSpace(next)
+	if strings.Contains(filter, "[") || !strings.ContainsAny(filter, "<>=") {
+		return nil
+	}
+
+	if _, ok := selectorNames[next]; ok || next == "" || strings.ContainsAny(next, "[<>=") {
+		return nil
+	}
+
+	return fmt.Errorf("invalid format '%s%c%s': put a filter in brackets if its value has '%c', e.g. [%s%c%s]", filter, sep, next, sep, filter, sep, next)
+}
+
+func parseFormatSelector(s string) (*formatSelector, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, errors.New("invalid format: empty selector")
+	}
+
+	name := s
+	filters := ""
+
+	if i := strings.IndexByte(s, '['); i >= 0 {
+		if !strings.HasSuffix(s, "]") {
+			return nil, fmt.Errorf("invalid format '%s': missing ']'", s)
+		}
+		name = strings.TrimSpace(s[:i])
+		filters = s[i+1 : len(s)-1]
+	} else if strings.ContainsAny(s, "<>=") {
+		name = ""
+		filters = s
+	}
+
+	selector := &formatSelector{}
+	if name == "" {
+		name = "best"
+	}
+	if named, ok := selectorNames[name]; ok {
+		*selector = named
+	} else {
+		selector.id = name
+	}
+
+	if strings.TrimSpace(filters) == "" {
+		if len(filters) > 0 || strings.Contains(s, "[") {
+			return nil, fmt.Errorf("invalid format '%s': empty filter", s)
+		}
+		return selector, nil
+	}
+
+	for _, f := range strings.Split(filters, ",") {
+		m := filterPattern.FindStringSubmatch(f)
+		if m == nil {
+			return nil, fmt.Errorf("invalid format filter '%s'", strings.TrimSpace(f))
+		}
+
+		selector.filters = append(selector.filters, &formatFilter{
+			field:    m[1],
+			op:       m[2],
+			optional: m[3] == "?",
+			value:    m[4],
+		})
+	}
+
+	return selector, nil
+}
+
+// Select evaluates the alternatives in order and returns the first one which
+// matches. Either return value is nil if the alternative does not choose it.
+func (s *Selector) Select(mj *MasterJson) (*Video, *Audio, error) {
+	for _, selectors := range s.alternatives {
+		if len(selectors) == 2 {
+			video, err := selectTrack(mj.TracksOf(VideoTrack), selectors[0])
+			if err != nil {
+				return nil, nil, err
+			}
+
+			audio, err := selectTrack(mj.TracksOf(AudioTrack), selectors[1])
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if video != nil && audio != nil {
+				return video.(*Video), audio.(*Audio), nil
+			}
+			continue
+		}
+
+		if selectors[0].kind == audioFormat {
+			audio, err := selectTrack(mj.TracksOf(AudioTrack), selectors[0])
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if audio != nil {
+				return nil, audio.(*Audio), nil
+			}
+			continue
+		}
+
+		video, err := selectTrack(mj.TracksOf(VideoTrack), selectors[0])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if video != nil {
+			return video.(*Video), nil, nil
+		}
+	}
+
+	return nil, nil, fmt.Errorf("no format matches '%s'", s.expr)
+}
+
+func (s *Selector) String() string {
+	return s.expr
+}
+
+// selectTrack returns the track which the selector ranks first among the
+// tracks which match it, or nil if none matches.
+func selectTrack(tracks []Track, selector *formatSelector) (Track, error) {
+	var selected Track
+	for _, track := range tracks {
+		ok, err := selector.match(track.StreamInfo().Id, trackField(track))
+		if err != nil {
+			return nil, err
+		}
+
+		if ok && (selected == nil || selector.prefer(track, selected)) {
+			selected = track
+		}
+	}
+
+	return selected, nil
+}
+
+// prefer reports whether a candidate ranks before the current choice.
+func (s *formatSelector) prefer(track Track, current Track) bool {
+	bitrate, currentBitrate := track.StreamInfo().Bitrate, current.StreamInfo().Bitrate
+	if bitrate == currentBitrate {
+		bitrate, currentBitrate = trackQuality(track), trackQuality(current)
+	}
+
+	if s.worst {
+		return bitrate < currentBitrate
+	}
+
+	return bitrate > currentBitrate
+}
+
+func (s *formatSelector) match(id string, field func(string) (interface{}, bool)) (bool, error) {
+	if s.id != "" && s.id != id {
+		return false, nil
+	}
+
+	for _, f := range s.filters {
+		value, ok := field(f.field)
+		if !ok {
+			return false, fmt.Errorf("unknown format field '%s'", f.field)
+		}
+
+		matched, err := f.match(value)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func (f *formatFilter) match(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case float64:
+		if v == 0 {
+			return f.optional, nil
+		}
+
+		expected, err := strconv.ParseFloat(f.value, 64)
+		if err != nil {
+			return false, fmt.Errorf("format field '%s' requires a number: %s", f.field, f.value)
+		}
+
+		switch f.op {
+		case "=":
+			return v == expected, nil
+		case "!=":
+			return v != expected, nil
+		case "<":
+			return v < expected, nil
+		case "<=":
+			return v <= expected, nil
+		case ">":
+			return v > expected, nil
+		case ">=":
+			return v >= expected, nil
+		}
+	case string:
+		if v == "" {
+			return f.optional, nil
+		}
+
+		actual := strings.ToLower(v)
+		expected := strings.ToLower(f.value)
+		switch f.op {
+		case "=":
+			// codecs match by their family as well, e.g. avc1 matches avc1.64001F
+			return actual == expected || (isCodecField(f.field) && strings.HasPrefix(actual, expected+".")), nil
+		case "!=":
+			return actual != expected && !(isCodecField(f.field) && strings.HasPrefix(actual, expected+".")), nil
+		case "^=":
+			return strings.HasPrefix(actual, expected), nil
+		case "$=":
+			return strings.HasSuffix(actual, expected), nil
+		case "*=":
+			return strings.Contains(actual, expected), nil
+		}
+	}
+
+	return false, errors.New("format field '" + f.field + "' does not support '" + f.op + "'")
+}
+
+func isCodecField(field string) bool {
+	return field == "codec" || field == "codecs" || field == "vcodec" || field == "acodec"
+}
+
+// trackQuality breaks ties between tracks with the same bitrate: the height
+// of a video or the sample rate of an audio.
+func trackQuality(track Track) int {
+	switch t := track.(type) {
+	case *Video:
+		return t.Height
+	case *Audio:
+		return t.SampleRate
+	}
+
+	return 0
+}
+
+// trackField returns the format fields of a track: those of its kind, and
+// those which every stream has.
+func trackField(track Track) func(string) (interface{}, bool) {
+	return func(name string) (interface{}, bool) {
+		switch t := track.(type) {
+		case *Video:
+			if value, ok := videoField(t, name); ok {
+				return value, true
+			}
+		case *Audio:
+			if value, ok := audioField(t, name); ok {
+				return value, true
+			}
+		}
+
+		return streamField(track.StreamInfo(), name)
+	}
+}
+
+func streamField(s Stream, name string) (interface{}, bool) {
+	switch name {
+	case "id":
+		return s.Id, true
+	case "codec", "codecs":
+		return s.Codecs, true
+	case "mime_type":
+		return s.MimeType, true
+	case "bitrate", "tbr":
+		return float64(s.Bitrate), true
+	case "avg_bitrate":
+		return float64(s.AvgBitrate), true
+	case "duration":
+		return s.Duration, true
+	case "filesize", "size":
+		return float64(s.EstimatedSize()), true
+	}
+
+	return nil, false
+}
+
+func videoField(v *Video, name string) (interface{}, bool) {
+	switch name {
+	case "vcodec":
+		return v.Codecs, true
+	case "width":
+		return float64(v.Width), true
+	case "height":
+		return float64(v.Height), true
+	case "framerate", "fps":
+		return v.Framerate, true
+	}
+
+	return nil, false
+}
+
+func audioField(a *Audio, name string) (interface{}, bool) {
+	switch name {
+	case "acodec":
+		return a.Codecs, true
+	case "channels":
+		return float64(a.Channels), true
+	case "sample_rate", "asr":
+		return float64(a.SampleRate), true
+	case "abr":
+		return float64(a.Bitrate), true
+	}
+
+	return nil, false
+}
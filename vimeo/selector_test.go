@@ -0,0 +1,142 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vimeo
+
+import (
+	"testing"
+)
+
+func newSelectorMasterJson() *MasterJson {
+	return &MasterJson{
+		Video: []Video{
+			Video{Id: "1080p", Codecs: "avc1.640028", Width: 1920, Height: 1080, Framerate: 30, Bitrate: 5000000},
+			Video{Id: "720p", Codecs: "avc1.64001F", Width: 1280, Height: 720, Framerate: 30, Bitrate: 2500000},
+			Video{Id: "720p-hevc", Codecs: "hvc1.1.6.L93.90", Width: 1280, Height: 720, Framerate: 60, Bitrate: 2000000},
+			Video{Id: "360p", Codecs: "avc1.4D401E", Width: 640, Height: 360, Framerate: 30, Bitrate: 600000},
+		},
+		Audio: []Audio{
+			Audio{Id: "a-high", Codecs: "mp4a.40.2", Channels: 2, SampleRate: 48000, Bitrate: 256000},
+			Audio{Id: "a-low", Codecs: "mp4a.40.2", Channels: 1, SampleRate: 44100, Bitrate: 64000},
+			Audio{Id: "a-opus", Codecs: "opus", Channels: 6, Bitrate: 128000},
+		},
+	}
+}
+
+func TestSelectorSelect(t *testing.T) {
+	cases := []struct {
+		expr          string
+		expectedVideo string
+		expectedAudio string
+	}{
+		{"best", "1080p", ""},
+		{"worst", "360p", ""},
+		{"bestvideo+bestaudio", "1080p", "a-high"},
+		{"bv+wa", "1080p", "a-low"},
+		{"bestvideo[height<=720]+bestaudio", "720p", "a-high"},
+		{"height<=720,codec=avc1/best", "720p", ""},
+		{"height<=720,codec=av01/best", "1080p", ""},
+		{"bestvideo[fps>30]", "720p-hevc", ""},
+		{"bestvideo[height=480]+bestaudio/bestvideo[height<480]+bestaudio", "360p", "a-high"},
+		{"720p+bestaudio[channels=1]", "720p", "a-low"},
+		{"bestaudio[codec^=mp4a,sample_rate<48000]", "", "a-low"},
+		{"bestaudio[sample_rate>=?48000,channels>2]", "", "a-opus"},
+		{"worstvideo[codec!=avc1]", "720p-hevc", ""},
+		{"height<=720+bestaudio", "720p", "a-high"},
+		{"bestvideo[mime_type=video/mp4]/best", "1080p", ""},
+	}
+
+	masterJson := newSelectorMasterJson()
+	for _, c := range cases {
+		selector, err := ParseSelector(c.expr)
+		if err != nil {
+			t.Errorf("ParseSelector failed for '%s': %v", c.expr, err)
+			continue
+		}
+
+		video, audio, err := selector.Select(masterJson)
+		if err != nil {
+			t.Errorf("Select failed for '%s': %v", c.expr, err)
+			continue
+		}
+
+		actualVideo := ""
+		if video != nil {
+			actualVideo = video.Id
+		}
+		actualAudio := ""
+		if audio != nil {
+			actualAudio = audio.Id
+		}
+
+		if actualVideo != c.expectedVideo || actualAudio != c.expectedAudio {
+			t.Errorf("Select does not match for '%s'.\nexpected: %v+%v\nactual:   %v+%v", c.expr, c.expectedVideo, c.expectedAudio, actualVideo, actualAudio)
+		}
+	}
+}
+
+func TestSelectorSelectWithNoMatch(t *testing.T) {
+	selector, err := ParseSelector("bestvideo[height>1080]/bestvideo[codec=av01]")
+	if err != nil {
+		t.Errorf("ParseSelector failed: %v", err)
+		return
+	}
+
+	_, _, err = selector.Select(newSelectorMasterJson())
+	if err == nil {
+		t.Errorf("Select must fail when no alternative matches")
+	}
+}
+
+func TestSelectorSelectWithInvalidFilter(t *testing.T) {
+	cases := []string{
+		"bestvideo[resolution=720]",
+		"bestvideo[height<=high]",
+		"bestvideo[codec<avc1]",
+	}
+
+	for _, expr := range cases {
+		selector, err := ParseSelector(expr)
+		if err != nil {
+			t.Errorf("ParseSelector failed for '%s': %v", expr, err)
+			continue
+		}
+
+		_, _, err = selector.Select(newSelectorMasterJson())
+		if err == nil {
+			t.Errorf("Select must fail for '%s'", expr)
+		}
+	}
+}
+
+func TestParseSelectorWithInvalidSyntax(t *testing.T) {
+	cases := []string{
+		"bestvideo[height<=720",
+		"bestvideo[]",
+		"bestvideo[height~720]",
+		"bestvideo+bestaudio+bestaudio",
+		"bestaudio+bestvideo",
+		"best/",
+		"mime_type=video/mp4",
+		"bestaudio+codec=mp4a+a1",
+		"height<=720/720p",
+	}
+
+	for _, expr := range cases {
+		_, err := ParseSelector(expr)
+		if err == nil {
+			t.Errorf("ParseSelector must fail for '%s'", expr)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vimeo
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// TrackState is the progress of a single output file. Offset is the size of
+// the file after the init segment and the first Segments segments.
+type TrackState struct {
+	Segments int   `json:"segments"`
+	Offset   int64 `json:"offset"`
+}
+
+// ResumeState is persisted next to the outputs so that an interrupted
+// download can continue where it stopped.
+type ResumeState struct {
+	MasterJsonUrl   string     `json:"master_json_url"`
+	ClipId          string     `json:"clip_id"`
+	VideoId         string     `json:"video_id"`
+	AudioId         string     `json:"audio_id,omitempty"`
+	Start           float64    `json:"start,omitempty"`
+	End             float64    `json:"end,omitempty"`
+	TimestampOffset float64    `json:"timestamp_offset,omitempty"`
+	Video           TrackState `json:"video"`
+	Audio           TrackState `json:"audio"`
+}
+
+func LoadResumeState(filename string) (*ResumeState, error) {
+	jsonBlob, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	state := new(ResumeState)
+	err = json.Unmarshal(jsonBlob, state)
+	if err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// Save writes the state to a temporary file and renames it, so that a crash
+// never leaves a half-written state behind.
+func (s *ResumeState) Save(filename string) error {
+	jsonBlob, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpFilename := filename + ".tmp"
+	err = os.WriteFile(tmpFilename, jsonBlob, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFilename, filename)
+}
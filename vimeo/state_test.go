@@ -0,0 +1,50 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vimeo
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResumeStateSaveAndLoad(t *testing.T) {
+	expected := &ResumeState{
+		MasterJsonUrl: "https://example.com/master.json",
+		ClipId:        "foo",
+		VideoId:       "1080p",
+		AudioId:       "bar",
+		Video:         TrackState{Segments: 3, Offset: 1024},
+		Audio:         TrackState{Segments: 0, Offset: 0},
+	}
+
+	filename := filepath.Join(t.TempDir(), "foo.state.json")
+	err := expected.Save(filename)
+	if err != nil {
+		t.Errorf("Save failed: %v", err)
+		return
+	}
+
+	actual, err := LoadResumeState(filename)
+	if err != nil {
+		t.Errorf("LoadResumeState failed: %v", err)
+		return
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("LoadResumeState state does not match.\nexpected: %v\nactual:   %v", expected, actual)
+		return
+	}
+}
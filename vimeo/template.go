@@ -0,0 +1,136 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vimeo
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// missingField is the value of fields which are unknown, e.g. audio fields
+// of a clip without audio.
+const missingField = "NA"
+
+var templateField = regexp.MustCompile(`%(?:%|\(([a-z_]+)\)([sd]))`)
+
+// TemplateFields returns the fields of an output template for a video and
+// an audio, either of which may be nil.
+func TemplateFields(mj *MasterJson, video *Video, audio *Audio) map[string]string {
+	fields := map[string]string{
+		"clip_id":     nonEmptyField(mj.ClipId),
+		"ext":         "mp4",
+		"format_id":   missingField,
+		"video_id":    missingField,
+		"audio_id":    missingField,
+		"width":       missingField,
+		"height":      missingField,
+		"resolution":  missingField,
+		"fps":         missingField,
+		"vcodec":      missingField,
+		"vbr":         missingField,
+		"acodec":      missingField,
+		"abr":         missingField,
+		"channels":    missingField,
+		"sample_rate": missingField,
+		"duration":    missingField,
+	}
+
+	ids := []string{}
+	if video != nil {
+		ids = append(ids, video.Id)
+		fields["video_id"] = nonEmptyField(video.Id)
+		fields["width"] = intField(video.Width)
+		fields["height"] = intField(video.Height)
+		if video.Width > 0 && video.Height > 0 {
+			fields["resolution"] = fmt.Sprintf("%dx%d", video.Width, video.Height)
+		}
+		if video.Framerate > 0 {
+			fields["fps"] = strconv.FormatFloat(video.Framerate, 'f', -1, 64)
+		}
+		fields["vcodec"] = nonEmptyField(video.Codecs)
+		fields["vbr"] = intField(video.Bitrate / 1000)
+		fields["duration"] = intField(int(video.Duration))
+	}
+
+	if audio != nil {
+		ids = append(ids, audio.Id)
+		fields["audio_id"] = nonEmptyField(audio.Id)
+		fields["acodec"] = nonEmptyField(audio.Codecs)
+		fields["abr"] = intField(audio.Bitrate / 1000)
+		fields["channels"] = intField(audio.Channels)
+		fields["sample_rate"] = intField(audio.SampleRate)
+		if fields["duration"] == missingField {
+			fields["duration"] = intField(int(audio.Duration))
+		}
+	}
+
+	if len(ids) > 0 {
+		fields["format_id"] = strings.Join(ids, "+")
+	}
+
+	return fields
+}
+
+func nonEmptyField(value string) string {
+	if len(value) == 0 {
+		return missingField
+	}
+
+	return value
+}
+
+func intField(value int) string {
+	if value <= 0 {
+		return missingField
+	}
+
+	return strconv.Itoa(value)
+}
+
+// RenderTemplate replaces %(name)s and %(name)d in template with fields, and
+// %% with %. Values are sanitized so that each one stays within a single
+// path element, while the template itself may contain directories.
+func RenderTemplate(template string, fields map[string]string) (string, error) {
+	var err error
+	rendered := templateField.ReplaceAllStringFunc(template, func(m string) string {
+		if m == "%%" {
+			return "%"
+		}
+
+		sub := templateField.FindStringSubmatch(m)
+		value, ok := fields[sub[1]]
+		if !ok {
+			if err == nil {
+				err = fmt.Errorf("unknown output template field '%s'", sub[1])
+			}
+			return m
+		}
+
+		if sub[2] == "d" && value != missingField {
+			if _, convErr := strconv.Atoi(value); convErr != nil && err == nil {
+				err = fmt.Errorf("output template field '%s' is not a number: %s", sub[1], value)
+			}
+		}
+
+		return SanitizeFilename(value)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return rendered, nil
+}
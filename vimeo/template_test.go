@@ -0,0 +1,102 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vimeo
+
+import (
+	"testing"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	mj := &MasterJson{ClipId: "clip1"}
+	video := &Video{Id: "v1", Width: 1280, Height: 720, Framerate: 29.97, Codecs: "avc1.64001F", Bitrate: 2500000, Duration: 12.5}
+	audio := &Audio{Id: "a1", Codecs: "mp4a.40.2", Bitrate: 128000, Channels: 2, SampleRate: 48000}
+	fields := TemplateFields(mj, video, audio)
+
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{"%(clip_id)s/%(height)sp-%(video_id)s.%(ext)s", "clip1/720p-v1.mp4"},
+		{"%(clip_id)s-%(format_id)s", "clip1-v1+a1"},
+		{"%(resolution)s@%(fps)s %(vcodec)s %(vbr)dk", "1280x720@29.97 avc1.64001F 2500k"},
+		{"%(acodec)s %(abr)dk %(channels)dch %(sample_rate)dHz %(duration)ds", "mp4a.40.2 128k 2ch 48000Hz 12s"},
+		{"100%% %(clip_id)s", "100% clip1"},
+	}
+
+	for _, test := range tests {
+		actual, err := RenderTemplate(test.template, fields)
+		if err != nil {
+			t.Errorf("RenderTemplate(%q) failed: %v", test.template, err)
+			return
+		}
+
+		if actual != test.expected {
+			t.Errorf("RenderTemplate(%q) does not match.\nexpected: %v\nactual:   %v", test.template, test.expected, actual)
+			return
+		}
+	}
+}
+
+func TestRenderTemplateWithoutAudio(t *testing.T) {
+	fields := TemplateFields(&MasterJson{ClipId: "clip1"}, &Video{Id: "v1"}, nil)
+	expected := "v1-NA-NA"
+
+	actual, err := RenderTemplate("%(format_id)s-%(audio_id)s-%(channels)d", fields)
+	if err != nil {
+		t.Errorf("RenderTemplate failed: %v", err)
+		return
+	}
+
+	if actual != expected {
+		t.Errorf("RenderTemplate does not match.\nexpected: %v\nactual:   %v", expected, actual)
+		return
+	}
+}
+
+func TestRenderTemplateSanitizesFields(t *testing.T) {
+	fields := TemplateFields(&MasterJson{ClipId: "../a/b:c"}, nil, nil)
+	expected := "out/_a_b_c.mp4"
+
+	actual, err := RenderTemplate("out/%(clip_id)s.%(ext)s", fields)
+	if err != nil {
+		t.Errorf("RenderTemplate failed: %v", err)
+		return
+	}
+
+	if actual != expected {
+		t.Errorf("RenderTemplate does not match.\nexpected: %v\nactual:   %v", expected, actual)
+		return
+	}
+}
+
+func TestRenderTemplateWithUnknownField(t *testing.T) {
+	fields := TemplateFields(&MasterJson{ClipId: "clip1"}, nil, nil)
+
+	_, err := RenderTemplate("%(title)s", fields)
+	if err == nil {
+		t.Errorf("RenderTemplate must fail for an unknown field")
+		return
+	}
+}
+
+func TestRenderTemplateWithNonNumericField(t *testing.T) {
+	fields := TemplateFields(&MasterJson{ClipId: "clip1"}, nil, nil)
+
+	_, err := RenderTemplate("%(clip_id)d", fields)
+	if err == nil {
+		t.Errorf("RenderTemplate must fail for %%d with a non-numeric field")
+		return
+	}
+}
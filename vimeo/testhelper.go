@@ -45,3 +45,10 @@ func NewMockReponseFromBytes(body []byte) *http.Response {
 		Body:       io.NopCloser(bytes.NewBuffer(body)),
 	}
 }
+
+func NewMockReponseWithStatus(statusCode int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: statusCode,
+		Body:       io.NopCloser(bytes.NewBufferString(body)),
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vimeo
+
+import (
+	"encoding/base64"
+	"fmt"
+)
+
+// TrackKind is the media type of a track, i.e. the key of its list in
+// master.json.
+type TrackKind string
+
+const (
+	VideoTrack TrackKind = "video"
+	AudioTrack TrackKind = "audio"
+)
+
+// Stream is a copy of the fields which every kind of track has in common:
+// how its init segment and media segments are found, and its bitrate.
+type Stream struct {
+	Id                 string
+	BaseUrl            string
+	Format             string
+	MimeType           string
+	Codecs             string
+	Bitrate            int
+	AvgBitrate         int
+	Duration           float64
+	MaxSegmentDuration float64
+	InitSegment        string
+	IndexSegment       string
+	InitSegmentRange   string
+	IndexSegmentRange  string
+	Segments           []Segment
+}
+
+// Track is a rendition of a clip, i.e. a *Video or an *Audio. Everything
+// which only needs the Stream of a track works for every kind, so a new kind,
+// also outside of this package, only has to implement these methods.
+type Track interface {
+	Kind() TrackKind
+	// StreamInfo returns the shared fields of the track.
+	StreamInfo() Stream
+	// SetSegments replaces the segments of the track and its duration.
+	SetSegments(segments []Segment, duration float64)
+}
+
+func (v *Video) Kind() TrackKind {
+	return VideoTrack
+}
+
+func (v *Video) StreamInfo() Stream {
+	return Stream{
+		Id:                 v.Id,
+		BaseUrl:            v.BaseUrl,
+		Format:             v.Format,
+		MimeType:           v.MimeType,
+		Codecs:             v.Codecs,
+		Bitrate:            v.Bitrate,
+		AvgBitrate:         v.AvgBitrate,
+		Duration:           v.Duration,
+		MaxSegmentDuration: v.MaxSegmentDuration,
+		InitSegment:        v.InitSegment,
+		IndexSegment:       v.IndexSegment,
+		InitSegmentRange:   v.InitSegmentRange,
+		IndexSegmentRange:  v.IndexSegmentRange,
+		Segments:           v.Segments,
+	}
+}
+
+func (v *Video) SetSegments(segments []Segment, duration float64) {
+	v.Segments = segments
+	v.Duration = duration
+}
+
+func (a *Audio) Kind() TrackKind {
+	return AudioTrack
+}
+
+func (a *Audio) StreamInfo() Stream {
+	return Stream{
+		Id:                 a.Id,
+		BaseUrl:            a.BaseUrl,
+		Format:             a.Format,
+		MimeType:           a.MimeType,
+		Codecs:             a.Codecs,
+		Bitrate:            a.Bitrate,
+		AvgBitrate:         a.AvgBitrate,
+		Duration:           a.Duration,
+		MaxSegmentDuration: a.MaxSegmentDuration,
+		InitSegment:        a.InitSegment,
+		IndexSegment:       a.IndexSegment,
+		InitSegmentRange:   a.InitSegmentRange,
+		IndexSegmentRange:  a.IndexSegmentRange,
+		Segments:           a.Segments,
+	}
+}
+
+func (a *Audio) SetSegments(segments []Segment, duration float64) {
+	a.Segments = segments
+	a.Duration = duration
+}
+
+func (s Stream) DecodedInitSegment() ([]byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(s.InitSegment)
+	if err != nil {
+		return nil, err
+	}
+
+	return decoded, err
+}
+
+// EstimatedSize returns the size of the track in bytes. The sum of segment
+// sizes is used if available, or else it is estimated from the bitrate.
+func (s Stream) EstimatedSize() int64 {
+	return estimateSize(s.Segments, s.AvgBitrate, s.Bitrate, s.Duration)
+}
+
+// Tracks returns the videos and then the audios of the clip. The tracks
+// point into mj, so changes to them are changes to mj.
+func (mj *MasterJson) Tracks() []Track {
+	tracks := make([]Track, 0, len(mj.Video)+len(mj.Audio))
+	for i := range mj.Video {
+		tracks = append(tracks, &mj.Video[i])
+	}
+
+	for i := range mj.Audio {
+		tracks = append(tracks, &mj.Audio[i])
+	}
+
+	return tracks
+}
+
+// TracksOf returns the tracks of a kind.
+func (mj *MasterJson) TracksOf(kind TrackKind) []Track {
+	tracks := []Track{}
+	for _, track := range mj.Tracks() {
+		if track.Kind() == kind {
+			tracks = append(tracks, track)
+		}
+	}
+
+	return tracks
+}
+
+func (mj *MasterJson) FindTrack(kind TrackKind, id string) (Track, error) {
+	if len(id) > 0 {
+		for _, track := range mj.TracksOf(kind) {
+			if track.StreamInfo().Id == id {
+				return track, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("A %s which has id '%s' is not found in MasterJson", kind, id)
+}
+
+// FindMaximumBitrateTrack returns the track of a kind with the highest
+// bitrate, or nil if there is none.
+func (mj *MasterJson) FindMaximumBitrateTrack(kind TrackKind) Track {
+	var found Track
+	for _, track := range mj.TracksOf(kind) {
+		if found == nil || track.StreamInfo().Bitrate > found.StreamInfo().Bitrate {
+			found = track
+		}
+	}
+
+	return found
+}
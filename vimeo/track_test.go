@@ -0,0 +1,155 @@
+// Copyright 2020 Akiomi Kamakura
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vimeo
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestTracks(t *testing.T) {
+	masterJson := MasterJson{
+		Video: []Video{
+			Video{Id: "1080p"},
+			Video{Id: "720p"},
+		},
+		Audio: []Audio{
+			Audio{Id: "a1"},
+		},
+	}
+
+	tracks := masterJson.Tracks()
+	expected := []string{"video 1080p", "video 720p", "audio a1"}
+	if len(tracks) != len(expected) {
+		t.Errorf("Tracks length does not match.\nexpected: %v\nactual:   %v", len(expected), len(tracks))
+		return
+	}
+
+	for i, track := range tracks {
+		actual := string(track.Kind()) + " " + track.StreamInfo().Id
+		if actual != expected[i] {
+			t.Errorf("Track %d does not match.\nexpected: %v\nactual:   %v", i, expected[i], actual)
+			return
+		}
+	}
+
+	tracks[2].SetSegments([]Segment{Segment{Url: "segment-1.m4s", End: 6}}, 6)
+	if len(masterJson.Audio[0].Segments) != 1 || masterJson.Audio[0].Duration != 6 {
+		t.Errorf("Tracks must point into the master.json")
+		return
+	}
+
+	audios := masterJson.TracksOf(AudioTrack)
+	if len(audios) != 1 || audios[0].(*Audio) != &masterJson.Audio[0] {
+		t.Errorf("TracksOf does not match: %v", audios)
+		return
+	}
+}
+
+func TestFindTrack(t *testing.T) {
+	masterJson := MasterJson{
+		Video: []Video{
+			Video{Id: "same"},
+		},
+		Audio: []Audio{
+			Audio{Id: "same", SampleRate: 48000},
+		},
+	}
+
+	track, err := masterJson.FindTrack(AudioTrack, "same")
+	if err != nil {
+		t.Errorf("FindTrack failed: %v", err)
+		return
+	}
+
+	audio, ok := track.(*Audio)
+	if !ok || audio.SampleRate != 48000 {
+		t.Errorf("FindTrack must find the track of the kind: %v", track)
+		return
+	}
+
+	_, err = masterJson.FindTrack(VideoTrack, "missing")
+	expected := "A video which has id 'missing' is not found in MasterJson"
+	if err == nil || err.Error() != expected {
+		t.Errorf("FindTrack error does not match.\nexpected: %v\nactual:   %v", expected, err)
+		return
+	}
+}
+
+func TestFindMaximumBitrateTrack(t *testing.T) {
+	masterJson := MasterJson{
+		Audio: []Audio{
+			Audio{Id: "low", Bitrate: 64000},
+			Audio{Id: "high", Bitrate: 256000},
+		},
+	}
+
+	track := masterJson.FindMaximumBitrateTrack(AudioTrack)
+	if track == nil || track.StreamInfo().Id != "high" {
+		t.Errorf("FindMaximumBitrateTrack does not match: %v", track)
+		return
+	}
+
+	if masterJson.FindMaximumBitrateTrack(VideoTrack) != nil {
+		t.Errorf("FindMaximumBitrateTrack must be nil without tracks of the kind")
+		return
+	}
+}
+
+func TestResumeTrackFileContext(t *testing.T) {
+	client := NewClient()
+	client.Client = NewMockClient(func(req *http.Request) *http.Response {
+		return NewMockReponseFromString(req.URL.Path)
+	})
+
+	masterJson := MasterJson{
+		BaseUrl: "../",
+		Audio: []Audio{
+			Audio{
+				Id:          "a1",
+				BaseUrl:     "audio/",
+				InitSegment: "aW5pdA==",
+				Segments:    []Segment{Segment{Url: "segment-1.m4s"}, Segment{Url: "segment-2.m4s"}},
+			},
+		},
+	}
+
+	var events []TrackEvent
+	client.Hooks.Completed = func(e TrackEvent) {
+		events = append(events, e)
+	}
+
+	masterJsonUrl, _ := url.Parse("https://example.com/video/1/master.json")
+	output := new(bytes.Buffer)
+	err := masterJson.ResumeTrackFileContext(context.Background(), output, masterJsonUrl, &masterJson.Audio[0], client, 0, new(TrackState), nil)
+	if err != nil {
+		t.Errorf("ResumeTrackFileContext failed: %v", err)
+		return
+	}
+
+	expected := "init/video/audio/segment-1.m4s/video/audio/segment-2.m4s"
+	if output.String() != expected {
+		t.Errorf("ResumeTrackFileContext output does not match.\nexpected: %v\nactual:   %v", expected, output.String())
+		return
+	}
+
+	if len(events) != 1 || events[0].Type != "audio" || events[0].Id != "a1" || events[0].Segments != 2 {
+		t.Errorf("ResumeTrackFileContext must report the track: %v", events)
+		return
+	}
+}